@@ -0,0 +1,371 @@
+package mmpd
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linkdata/deadlock"
+)
+
+// ErrNoCoverArt is returned if neither albumart nor readpicture found an image.
+var ErrNoCoverArt = errors.New("no cover art")
+
+// CoverArtSource names the MPD command used to retrieve cover art.
+type CoverArtSource string
+
+const (
+	// CoverArtAlbumArt is a cover file (e.g. cover.jpg) in the song's directory.
+	CoverArtAlbumArt CoverArtSource = "albumart"
+
+	// CoverArtReadPicture is a picture embedded in the song file.
+	CoverArtReadPicture CoverArtSource = "readpicture"
+)
+
+// CoverArt is an image retrieved for a song.
+type CoverArt struct {
+	// the cache key the image is stored under
+	Key string
+
+	// the raw image data
+	Data []byte
+
+	// the image MIME type, as sniffed from Data
+	MimeType string
+
+	// set if the song has no cover art; Data is empty then
+	Missing bool
+}
+
+// CoverArtKey returns the key cover art of entry is cached under.
+//
+// Songs of the same album share a key, so the cover is fetched only once per album.
+// Songs without an album tag are keyed by their file.
+func CoverArtKey(entry *PlaylistEntry) string {
+	if entry == nil {
+		return ""
+	}
+	if entry.Album != "" {
+		artist := entry.AlbumArtist
+		if artist == "" {
+			artist = entry.Artist
+		}
+		return "album:" + artist + "\x00" + entry.Album
+	}
+	return "file:" + entry.File
+}
+
+type CoverArtOption func(*CoverArtService)
+
+// WithCoverArtCacheDir enables the on-disk cache in dir.
+func WithCoverArtCacheDir(dir string) CoverArtOption {
+	return func(s *CoverArtService) {
+		s.cacheDir = dir
+	}
+}
+
+// WithCoverArtMemoryLimit sets the number of bytes kept in the in-memory cache.
+func WithCoverArtMemoryLimit(limit int) CoverArtOption {
+	return func(s *CoverArtService) {
+		s.memoryLimit = limit
+	}
+}
+
+// WithCoverArtSources sets the commands tried to retrieve cover art, in order.
+//
+// The default is to try albumart first and fall back to readpicture.
+func WithCoverArtSources(sources ...CoverArtSource) CoverArtOption {
+	return func(s *CoverArtService) {
+		if len(sources) > 0 {
+			s.sources = sources
+		}
+	}
+}
+
+type coverArtCacheEntry struct {
+	key string
+	art *CoverArt // nil if the song has no cover art
+}
+
+// CoverArtService fetches and caches cover art for the songs of a ReconnectingClient.
+//
+// The current and next song of CurrentSongCache are prefetched whenever the
+// current song changes, and CoverArtChangedListeners are notified when the
+// cover art of the current song becomes available, or with a CoverArt with
+// Missing set if it turns out to have none. Failed fetches are not notified.
+type CoverArtService struct {
+	client                   *ReconnectingClient
+	cacheDir                 string
+	memoryLimit              int
+	sources                  []CoverArtSource
+	lock                     deadlock.Mutex
+	memory                   map[string]*list.Element
+	lru                      *list.List
+	memoryUsed               int
+	inflight                 map[string]chan struct{}
+	current                  *PlaylistEntry
+	currentSongListener      *CurrentSongChangedListener
+	CoverArtChangedListeners *ListenerSet[*CoverArtChangedListener]
+}
+
+func NewCoverArtService(client *ReconnectingClient, options ...CoverArtOption) (*CoverArtService, error) {
+	s := &CoverArtService{
+		client:                   client,
+		memoryLimit:              32 << 20,
+		sources:                  []CoverArtSource{CoverArtAlbumArt, CoverArtReadPicture},
+		memory:                   make(map[string]*list.Element),
+		lru:                      list.New(),
+		inflight:                 make(map[string]chan struct{}),
+		CoverArtChangedListeners: NewListenerSet[*CoverArtChangedListener](),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	if s.cacheDir != "" {
+		if err := os.MkdirAll(s.cacheDir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	s.currentSongListener = NewCurrentSongChangedListener(func(client *ReconnectingClient, currentSong *CurrentSong) {
+		s.currentSongChanged(currentSong)
+	})
+	client.CurrentSongChangedListeners.Add(s.currentSongListener)
+	if currentSong := client.CurrentSongCache.Load(); currentSong != nil {
+		go s.currentSongChanged(currentSong)
+	}
+
+	return s, nil
+}
+
+// Close stops following the current song of the client.
+func (s *CoverArtService) Close() {
+	s.client.CurrentSongChangedListeners.Remove(s.currentSongListener)
+}
+
+// Current returns the cached cover art of the current song, or nil if it is
+// not available (yet).
+func (s *CoverArtService) Current() *CoverArt {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.current == nil {
+		return nil
+	}
+	if elem, ok := s.memory[CoverArtKey(s.current)]; ok {
+		return elem.Value.(*coverArtCacheEntry).art
+	}
+	return nil
+}
+
+// Prefetch fetches the cover art of entries in the background.
+func (s *CoverArtService) Prefetch(entries ...*PlaylistEntry) {
+	for _, entry := range entries {
+		if entry == nil || entry.File == "" {
+			continue
+		}
+		go func(entry *PlaylistEntry) {
+			if _, err := s.Get(entry); err != nil && !errors.Is(err, ErrNoCoverArt) {
+				fmt.Printf("mpd: prefetching cover art for %s failed: %v\n", entry.File, err)
+			}
+		}(entry)
+	}
+}
+
+// Get returns the cover art of entry, fetching it from MPD if it is not cached.
+//
+// ErrNoCoverArt is returned if the song has no cover art.
+func (s *CoverArtService) Get(entry *PlaylistEntry) (*CoverArt, error) {
+	if entry == nil || entry.File == "" {
+		return nil, ErrNoCoverArt
+	}
+	key := CoverArtKey(entry)
+
+	for {
+		s.lock.Lock()
+		if elem, ok := s.memory[key]; ok {
+			s.lru.MoveToFront(elem)
+			art := elem.Value.(*coverArtCacheEntry).art
+			s.lock.Unlock()
+			if art == nil {
+				return nil, ErrNoCoverArt
+			}
+			return art, nil
+		}
+		if ch, ok := s.inflight[key]; ok {
+			// another goroutine is fetching the same key
+			s.lock.Unlock()
+			<-ch
+			continue
+		}
+		ch := make(chan struct{})
+		s.inflight[key] = ch
+		s.lock.Unlock()
+
+		art, err := s.load(key, entry)
+
+		s.lock.Lock()
+		delete(s.inflight, key)
+		close(ch)
+		if err == nil || errors.Is(err, ErrNoCoverArt) {
+			s.store(key, art)
+		}
+		isCurrent := s.current != nil && CoverArtKey(s.current) == key
+		current := s.current
+		s.lock.Unlock()
+
+		if isCurrent && (err == nil || errors.Is(err, ErrNoCoverArt)) {
+			notified := art
+			if notified == nil {
+				notified = &CoverArt{Key: key, Missing: true}
+			}
+			s.CoverArtChangedListeners.Notify(func(l *CoverArtChangedListener) {
+				l.CoverArtChanged(s, current, notified)
+			})
+		}
+		return art, err
+	}
+}
+
+func (s *CoverArtService) currentSongChanged(currentSong *CurrentSong) {
+	if currentSong == nil {
+		return
+	}
+
+	s.lock.Lock()
+	changed := CoverArtKey(s.current) != CoverArtKey(currentSong.CurrentSong)
+	s.current = currentSong.CurrentSong
+	var art *CoverArt
+	cached := false
+	if elem, ok := s.memory[CoverArtKey(s.current)]; ok {
+		art, cached = elem.Value.(*coverArtCacheEntry).art, true
+	}
+	s.lock.Unlock()
+
+	if cached && art == nil {
+		// the cache records that the song has no cover art
+		art = &CoverArt{Key: CoverArtKey(currentSong.CurrentSong), Missing: true}
+	}
+
+	if changed && cached {
+		// already prefetched, so the new art is available right away
+		s.CoverArtChangedListeners.Notify(func(l *CoverArtChangedListener) {
+			l.CoverArtChanged(s, currentSong.CurrentSong, art)
+		})
+	}
+
+	s.Prefetch(currentSong.CurrentSong, currentSong.NextSong)
+}
+
+// load reads the cover art from the disk cache or from MPD.
+func (s *CoverArtService) load(key string, entry *PlaylistEntry) (*CoverArt, error) {
+	if s.cacheDir != "" {
+		if data, err := os.ReadFile(s.cacheFile(key)); err == nil {
+			if len(data) == 0 {
+				return nil, ErrNoCoverArt
+			}
+			return &CoverArt{Key: key, Data: data, MimeType: http.DetectContentType(data)}, nil
+		}
+	}
+
+	var data []byte
+	err := s.client.DoIdempotent(func(client *ReconnectingClient) error {
+		for _, source := range s.sources {
+			var err error
+			if data, err = readBinaryChunked(client, string(source), entry.File); err == nil {
+				fmt.Printf("mpd: received cover art for %s via %s (%d bytes)\n", entry.File, source, len(data))
+				return nil
+			} else if !errors.Is(err, ErrNoCoverArt) {
+				return err
+			}
+		}
+		return ErrNoCoverArt
+	})
+	if err != nil && !errors.Is(err, ErrNoCoverArt) {
+		return nil, err
+	}
+
+	if s.cacheDir != "" {
+		// an empty file records that there is no cover art
+		if werr := os.WriteFile(s.cacheFile(key), data, 0o644); werr != nil {
+			fmt.Printf("mpd: writing cover art cache failed: %v\n", werr)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &CoverArt{Key: key, Data: data, MimeType: http.DetectContentType(data)}, nil
+}
+
+// store adds art to the in-memory cache and evicts the least recently used entries.
+//
+// Must be called with lock held.
+func (s *CoverArtService) store(key string, art *CoverArt) {
+	if elem, ok := s.memory[key]; ok {
+		s.lru.Remove(elem)
+		s.memoryUsed -= coverArtSize(elem.Value.(*coverArtCacheEntry).art)
+	}
+	s.memory[key] = s.lru.PushFront(&coverArtCacheEntry{key: key, art: art})
+	s.memoryUsed += coverArtSize(art)
+
+	for s.memoryUsed > s.memoryLimit && s.lru.Len() > 1 {
+		elem := s.lru.Back()
+		entry := elem.Value.(*coverArtCacheEntry)
+		s.lru.Remove(elem)
+		delete(s.memory, entry.key)
+		s.memoryUsed -= coverArtSize(entry.art)
+	}
+}
+
+func (s *CoverArtService) cacheFile(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+func coverArtSize(art *CoverArt) int {
+	if art == nil {
+		return 0
+	}
+	return len(art.Data)
+}
+
+// readBinaryChunked reads the complete binary response of a chunked command like
+// albumart or readpicture.
+func readBinaryChunked(client *ReconnectingClient, command string, uri string) ([]byte, error) {
+	var data []byte
+	for {
+		chunk, size, err := client.Command(command+" %s %d", uri, len(data)).Binary()
+		if err != nil {
+			var protoErr textproto.ProtocolError
+			if errors.Is(asAckError(err), ErrAckNoExist) {
+				return nil, ErrNoCoverArt
+			} else if errors.As(err, &protoErr) && strings.HasPrefix(string(protoErr), "no binary data") {
+				// readpicture answers with a plain OK if there is no picture
+				return nil, ErrNoCoverArt
+			}
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		data = append(data, chunk...)
+		if len(data) >= size {
+			break
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, ErrNoCoverArt
+	}
+	return data, nil
+}
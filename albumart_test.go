@@ -0,0 +1,105 @@
+package mmpd_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+// testImage returns a PNG-looking image of size bytes.
+func testImage(size int) []byte {
+	image := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("\x00\n\xff"), size)...)
+	return image[:size]
+}
+
+// receivedCommands returns the lines of the name commands received by srv.
+func receivedCommands(srv *mpdtest.Server, name string) []string {
+	var lines []string
+	for _, line := range srv.Received() {
+		if strings.HasPrefix(line, name+" ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestCoverArtChunks(t *testing.T) {
+	image := testImage(20000)
+	srv := startServer(t, mpdtest.WithAlbumArt("a", image))
+	client := connect(t, srv)
+	service, err := mmpd.NewCoverArtService(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	art, err := service.Get(&mmpd.PlaylistEntry{File: "a/1.flac", Artist: "A", Album: "First"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(art.Data, image) || art.MimeType != "image/png" || art.Missing {
+		t.Errorf("got %d bytes of %s, want %d bytes of image/png", len(art.Data), art.MimeType, len(image))
+	}
+	want := []string{`albumart "a/1.flac" 0`, `albumart "a/1.flac" 8192`, `albumart "a/1.flac" 16384`}
+	if got := receivedCommands(srv, "albumart"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	// the songs of the album share the cover
+	if _, err := service.Get(&mmpd.PlaylistEntry{File: "a/2.flac", Artist: "A", Album: "First"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(receivedCommands(srv, "albumart")); n != 3 {
+		t.Errorf("cached cover fetched again, %d albumart commands", n)
+	}
+}
+
+func TestCoverArtReadPictureFallback(t *testing.T) {
+	image := testImage(100)
+	srv := startServer(t, mpdtest.WithPicture("b/1.flac", image))
+	client := connect(t, srv)
+	service, err := mmpd.NewCoverArtService(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	art, err := service.Get(&mmpd.PlaylistEntry{File: "b/1.flac", Artist: "B", Album: "Second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(art.Data, image) {
+		t.Errorf("got %d bytes, want %d", len(art.Data), len(image))
+	}
+	if got := receivedCommands(srv, "albumart"); len(got) != 1 {
+		t.Errorf("sent %q, want a single albumart", got)
+	}
+	if got := receivedCommands(srv, "readpicture"); len(got) != 1 || got[0] != `readpicture "b/1.flac" 0` {
+		t.Errorf("sent %q", got)
+	}
+}
+
+func TestCoverArtMissing(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	service, err := mmpd.NewCoverArtService(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	entry := &mmpd.PlaylistEntry{File: "a/1.flac", Artist: "A", Album: "First"}
+	for i := 0; i < 2; i++ {
+		if art, err := service.Get(entry); !errors.Is(err, mmpd.ErrNoCoverArt) {
+			t.Errorf("got %+v, %v, want ErrNoCoverArt", art, err)
+		}
+	}
+	// the missing cover is cached too
+	if albumart, readpicture := receivedCommands(srv, "albumart"), receivedCommands(srv, "readpicture"); len(albumart) != 1 || len(readpicture) != 1 {
+		t.Errorf("sent %q and %q", albumart, readpicture)
+	}
+}
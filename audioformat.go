@@ -0,0 +1,228 @@
+package mmpd
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SampleFormat is the sample format of an AudioFormat: the bit depth of
+// integer samples ("8", "16", "24", "32"), "f" for 32 bit floating point, or
+// "dsd" for DSD.
+type SampleFormat string
+
+const (
+	SampleFormatS8    SampleFormat = "8"
+	SampleFormatS16   SampleFormat = "16"
+	SampleFormatS24   SampleFormat = "24"
+	SampleFormatS32   SampleFormat = "32"
+	SampleFormatFloat SampleFormat = "f"
+	SampleFormatDSD   SampleFormat = "dsd"
+)
+
+// AudioFormat is an MPD audio format, "samplerate:format:channels", like
+// "44100:16:2", "192000:f:2" or "dsd64:2". In masks, each component may be
+// "*", which is represented by its zero value.
+//
+// DSD sample rates are in MPD's representation, the bit rate per channel
+// divided by 8; "dsd64:2" has the SampleRate 352800. DSD played as DSD over
+// PCM (DoP) is still reported as DSD.
+type AudioFormat struct {
+	// frames per second, 0 if unknown
+	SampleRate int
+
+	// "" if unknown
+	SampleFormat SampleFormat
+
+	// 0 if unknown
+	Channels int
+}
+
+// ParseAudioFormat parses s. An empty s is the zero AudioFormat.
+func ParseAudioFormat(s string) (AudioFormat, error) {
+	var af AudioFormat
+	if s == "" {
+		return af, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) == 2 && strings.HasPrefix(parts[0], "dsd") {
+		// dsdRATE:channels
+		rate, err := strconv.Atoi(strings.TrimPrefix(parts[0], "dsd"))
+		if err != nil || rate <= 0 {
+			return af, fmt.Errorf("invalid DSD rate in audio format '%s'", s)
+		}
+		af.SampleRate = rate * 44100 / 8
+		af.SampleFormat = SampleFormatDSD
+		parts = parts[1:]
+	} else if len(parts) == 3 {
+		if parts[0] != "*" {
+			rate, err := strconv.Atoi(parts[0])
+			if err != nil || rate <= 0 {
+				return af, fmt.Errorf("invalid sample rate in audio format '%s'", s)
+			}
+			af.SampleRate = rate
+		}
+		switch format := SampleFormat(parts[1]); format {
+		case SampleFormatS8, SampleFormatS16, SampleFormatS24, SampleFormatS32, SampleFormatFloat, SampleFormatDSD:
+			af.SampleFormat = format
+		case "*":
+		default:
+			return af, fmt.Errorf("invalid sample format in audio format '%s'", s)
+		}
+		parts = parts[2:]
+	} else {
+		return af, fmt.Errorf("invalid audio format '%s'", s)
+	}
+
+	if parts[0] != "*" {
+		channels, err := strconv.Atoi(parts[0])
+		if err != nil || channels <= 0 {
+			return af, fmt.Errorf("invalid channel count in audio format '%s'", s)
+		}
+		af.Channels = channels
+	}
+	return af, nil
+}
+
+// String formats af the way MPD does.
+func (af AudioFormat) String() string {
+	if af.IsZero() {
+		return ""
+	}
+
+	channels := "*"
+	if af.Channels > 0 {
+		channels = strconv.Itoa(af.Channels)
+	}
+	if rate := af.DSDRate(); rate > 0 && af.SampleRate*8%44100 == 0 {
+		return fmt.Sprintf("dsd%d:%s", rate, channels)
+	}
+
+	sampleRate := "*"
+	if af.SampleRate > 0 {
+		sampleRate = strconv.Itoa(af.SampleRate)
+	}
+	sampleFormat := string(af.SampleFormat)
+	if sampleFormat == "" {
+		sampleFormat = "*"
+	}
+	return sampleRate + ":" + sampleFormat + ":" + channels
+}
+
+func (af AudioFormat) IsZero() bool {
+	return af == AudioFormat{}
+}
+
+// IsMask reports whether any component of af is unknown ("*").
+func (af AudioFormat) IsMask() bool {
+	return af.SampleRate == 0 || af.SampleFormat == "" || af.Channels == 0
+}
+
+// Matches reports whether af matches mask, whose unknown components match anything.
+func (af AudioFormat) Matches(mask AudioFormat) bool {
+	return (mask.SampleRate == 0 || mask.SampleRate == af.SampleRate) &&
+		(mask.SampleFormat == "" || mask.SampleFormat == af.SampleFormat) &&
+		(mask.Channels == 0 || mask.Channels == af.Channels)
+}
+
+func (af AudioFormat) IsFloat() bool {
+	return af.SampleFormat == SampleFormatFloat
+}
+
+func (af AudioFormat) IsDSD() bool {
+	return af.SampleFormat == SampleFormatDSD
+}
+
+// DSDRate returns the DSD rate as multiple of 44.1 kHz, e.g. 64 for DSD64,
+// or 0 if af is not DSD.
+func (af AudioFormat) DSDRate() int {
+	if !af.IsDSD() {
+		return 0
+	}
+	return af.SampleRate * 8 / 44100
+}
+
+// SampleRateHz returns the sample rate in Hz; for DSD this is the bit rate
+// per channel, e.g. 2822400 for DSD64.
+func (af AudioFormat) SampleRateHz() int {
+	if af.IsDSD() {
+		return af.SampleRate * 8
+	}
+	return af.SampleRate
+}
+
+// BitDepth returns the bits per sample: 32 for floating point, 1 for DSD, and
+// 0 if unknown.
+func (af AudioFormat) BitDepth() int {
+	switch af.SampleFormat {
+	case SampleFormatFloat:
+		return 32
+	case SampleFormatDSD:
+		return 1
+	default:
+		bits, _ := strconv.Atoi(string(af.SampleFormat))
+		return bits
+	}
+}
+
+// Describe returns a short human-readable description, like "24/96 stereo",
+// "DSD64 stereo" or "float/44.1 5.1".
+func (af AudioFormat) Describe() string {
+	var parts []string
+	switch {
+	case af.IsDSD():
+		parts = append(parts, fmt.Sprintf("DSD%d", af.DSDRate()))
+	case af.SampleRate > 0 || af.SampleFormat != "":
+		depth := "?"
+		if af.IsFloat() {
+			depth = "float"
+		} else if bits := af.BitDepth(); bits > 0 {
+			depth = strconv.Itoa(bits)
+		}
+		rate := "?"
+		if af.SampleRate > 0 {
+			rate = strconv.FormatFloat(float64(af.SampleRate)/1000, 'f', -1, 64)
+		}
+		parts = append(parts, depth+"/"+rate)
+	}
+
+	switch af.Channels {
+	case 0:
+	case 1:
+		parts = append(parts, "mono")
+	case 2:
+		parts = append(parts, "stereo")
+	case 6:
+		parts = append(parts, "5.1")
+	case 8:
+		parts = append(parts, "7.1")
+	default:
+		parts = append(parts, fmt.Sprintf("%dch", af.Channels))
+	}
+	return strings.Join(parts, " ")
+}
+
+// losslessSuffixes are the file suffixes of lossless codecs. Containers like
+// m4a and mka, which hold lossless and lossy codecs alike, are not included.
+var losslessSuffixes = map[string]bool{
+	"flac": true, "wav": true, "wave": true, "aif": true, "aiff": true, "aifc": true,
+	"ape": true, "wv": true, "tta": true, "tak": true, "shn": true, "dsf": true, "dff": true,
+}
+
+// IsLossless reports whether the song file is in a lossless format, judged by
+// its suffix. The audio format MPD reports does not tell, as lossy decoders
+// output integer samples just like lossless ones. Songs in containers like
+// m4a, which may be ALAC or AAC, are reported as not lossless.
+func (pe *PlaylistEntry) IsLossless() bool {
+	file, _, _ := strings.Cut(pe.File, "?")
+	return losslessSuffixes[strings.ToLower(strings.TrimPrefix(path.Ext(file), "."))]
+}
+
+// IsHiRes reports whether the song is lossless (see IsLossless) and DSD, or
+// PCM with more than 16 bits or a sample rate above 48 kHz.
+func (pe *PlaylistEntry) IsHiRes() bool {
+	af := pe.AudioFormat
+	return pe.IsLossless() && (af.IsDSD() || af.BitDepth() > 16 || af.SampleRate > 48000)
+}
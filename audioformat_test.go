@@ -0,0 +1,58 @@
+package mmpd_test
+
+import (
+	"testing"
+
+	"github.com/mkke/mmpd"
+)
+
+func TestParseAudioFormat(t *testing.T) {
+	tests := []struct {
+		s        string
+		describe string
+	}{
+		{"44100:16:2", "16/44.1 stereo"},
+		{"96000:24:2", "24/96 stereo"},
+		{"48000:f:6", "float/48 5.1"},
+		{"dsd64:2", "DSD64 stereo"},
+		{"*:24:*", "24/?"},
+	}
+	for _, test := range tests {
+		af, err := mmpd.ParseAudioFormat(test.s)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+		if af.String() != test.s || af.Describe() != test.describe {
+			t.Errorf("%s: formatted as %s, described as %s", test.s, af, af.Describe())
+		}
+	}
+	for _, s := range []string{"44100:12:2", "dsd:2", "44100:16", "0:16:2"} {
+		if _, err := mmpd.ParseAudioFormat(s); err == nil {
+			t.Errorf("%s: no error", s)
+		}
+	}
+}
+
+func TestPlaylistEntryIsLossless(t *testing.T) {
+	tests := []struct {
+		file, format    string
+		lossless, hiRes bool
+	}{
+		{"a.flac", "44100:16:2", true, false},
+		{"a.FLAC", "96000:24:2", true, true},
+		{"a.dsf", "dsd64:2", true, true},
+		{"a.mp3", "44100:24:2", false, false},
+		{"a.ogg", "48000:f:2", false, false},
+		{"a.m4a", "44100:16:2", false, false},
+		{"http://radio.example/stream.flac?session=1", "48000:24:2", true, true},
+		{"http://radio.example/stream", "44100:16:2", false, false},
+	}
+	for _, test := range tests {
+		af, _ := mmpd.ParseAudioFormat(test.format)
+		entry := &mmpd.PlaylistEntry{File: test.file, Format: test.format, AudioFormat: af}
+		if entry.IsLossless() != test.lossless || entry.IsHiRes() != test.hiRes {
+			t.Errorf("%s %s: lossless %v, hi-res %v", test.file, test.format, entry.IsLossless(), entry.IsHiRes())
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PasswordProvider returns the current MPD password.
+//
+// It is called on each (re)connect and after permission errors, so rotated
+// passwords are picked up without restarting.
+type PasswordProvider func() (string, error)
+
+// WithPasswordProvider sets a provider that is asked for the password on each
+// (re)connect, replacing a password set with WithPassword.
+func WithPasswordProvider(provider PasswordProvider) ClientOption {
+	return func(client *ReconnectingClient) {
+		client.passwordProvider = provider
+	}
+}
+
+// PasswordFromEnv reads the password from the environment variable name.
+func PasswordFromEnv(name string) PasswordProvider {
+	return func() (string, error) {
+		if password, ok := os.LookupEnv(name); ok {
+			return password, nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+}
+
+// PasswordFromFile reads the password from file, ignoring surrounding whitespace.
+func PasswordFromFile(file string) PasswordProvider {
+	return func() (string, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+}
+
+// CommandSet is a set of MPD command names.
+type CommandSet map[string]struct{}
+
+func NewCommandSet(commands []string) CommandSet {
+	cs := make(CommandSet, len(commands))
+	for _, command := range commands {
+		cs[command] = struct{}{}
+	}
+	return cs
+}
+
+func (cs CommandSet) Contains(command string) bool {
+	_, ok := cs[command]
+	return ok
+}
+
+// Commands returns the commands the current connection is permitted to run,
+// as reported by the commands command after connecting or authenticating.
+//
+// nil is returned if the commands are not known.
+func (c *ReconnectingClient) Commands() CommandSet {
+	if commands := c.commands.Load(); commands != nil {
+		return *commands
+	}
+	return nil
+}
+
+// DeniedCommands returns the commands the current connection is not permitted
+// to run, as reported by the notcommands command.
+//
+// nil is returned if the commands are not known.
+func (c *ReconnectingClient) DeniedCommands() CommandSet {
+	if commands := c.deniedCommands.Load(); commands != nil {
+		return *commands
+	}
+	return nil
+}
+
+// CanRun reports whether the current connection is permitted to run command.
+// If the permitted commands are not known, CanRun returns true.
+func (c *ReconnectingClient) CanRun(command string) bool {
+	if denied := c.DeniedCommands(); denied != nil && denied.Contains(command) {
+		return false
+	}
+	commands := c.Commands()
+	return commands == nil || commands.Contains(command)
+}
+
+// SetPassword replaces the password (and any PasswordProvider) and, if
+// connected, authenticates the current connection with it.
+func (c *ReconnectingClient) SetPassword(password string) error {
+	c.credentialsLock.Lock()
+	c.password = password
+	c.passwordProvider = nil
+	c.credentialsLock.Unlock()
+
+	err := c.Do(func(client *ReconnectingClient) error {
+		return client.authenticate(password)
+	})
+	if errors.Is(err, ErrNotConnected) {
+		// used on the next connect
+		return nil
+	}
+	return err
+}
+
+// currentPassword returns the password to authenticate with, asking the
+// PasswordProvider if there is one. If the provider fails, the last known
+// password is used.
+func (c *ReconnectingClient) currentPassword() string {
+	c.credentialsLock.Lock()
+	defer c.credentialsLock.Unlock()
+
+	if c.passwordProvider != nil {
+		if password, err := c.passwordProvider(); err != nil {
+			fmt.Printf("mpd: password provider failed: %v; using last known password\n", err)
+		} else {
+			c.password = password
+		}
+	}
+	return c.password
+}
+
+// authenticate sends password on the current connection and reloads the
+// permitted commands.
+//
+// Must be called with connectLock held.
+func (c *ReconnectingClient) authenticate(password string) error {
+	if password != "" {
+		if err := c.Client.Command("password %s", password).OK(); err != nil {
+			return err
+		}
+	}
+	c.loadCommands()
+	return nil
+}
+
+// errPasswordUnchanged is returned by reauthenticate if there is no new
+// password to try.
+var errPasswordUnchanged = errors.New("password unchanged")
+
+// reauthenticate handles a permission error by authenticating again if the
+// PasswordProvider returns a new password, e.g. after it was rotated. The
+// password the connection authenticated with is not sent again, as MPD would
+// deny the command again anyway.
+//
+// Must be called with connectLock held.
+func (c *ReconnectingClient) reauthenticate() error {
+	// commands denied at the same time authenticate only once
+	c.reauthLock.Lock()
+	defer c.reauthLock.Unlock()
+
+	c.credentialsLock.Lock()
+	last := c.password
+	c.credentialsLock.Unlock()
+
+	password := c.currentPassword()
+	if password == "" || password == last {
+		return errPasswordUnchanged
+	}
+	fmt.Printf("mpd: permission denied; authenticating with new password\n")
+	if err := c.authenticate(password); err != nil {
+		return err
+	}
+	c.reauthentications.Add(1)
+	return nil
+}
+
+// loadCommands queries the commands the connection is permitted to run, and
+// those it is not.
+//
+// Must be called with connectLock held.
+func (c *ReconnectingClient) loadCommands() {
+	if commands, err := c.Client.Command("commands").Strings("command"); err != nil {
+		fmt.Printf("mpd: querying permitted commands failed: %v\n", err)
+		c.commands.Store(nil)
+	} else {
+		commandSet := NewCommandSet(commands)
+		c.commands.Store(&commandSet)
+	}
+
+	if commands, err := c.Client.Command("notcommands").Strings("command"); err != nil {
+		fmt.Printf("mpd: querying denied commands failed: %v\n", err)
+		c.deniedCommands.Store(nil)
+	} else {
+		commandSet := NewCommandSet(commands)
+		c.deniedCommands.Store(&commandSet)
+	}
+}
@@ -0,0 +1,48 @@
+package mmpd_test
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+func TestReauthenticateWithRotatedPassword(t *testing.T) {
+	srv := startServer(t, mpdtest.WithPassword("secret"))
+	var password atomic.Value
+	password.Store("")
+	client := connect(t, srv, mmpd.WithPasswordProvider(func() (string, error) {
+		return password.Load().(string), nil
+	}))
+
+	passwordsSent := func() (n int) {
+		for _, line := range srv.Received() {
+			if strings.HasPrefix(line, "password ") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// nothing to retry with while the provider has no new password
+	if err := client.DoIdempotent(mmpd.RefreshCache); !errors.Is(err, mmpd.ErrAckPermission) {
+		t.Fatalf("refresh without password: %v", err)
+	}
+	if n := passwordsSent(); n != 0 {
+		t.Errorf("%d passwords sent", n)
+	}
+
+	password.Store("secret")
+	if err := client.DoIdempotent(mmpd.RefreshCache); err != nil {
+		t.Fatalf("refresh with rotated password: %v", err)
+	}
+	if n := passwordsSent(); n != 1 {
+		t.Errorf("%d passwords sent", n)
+	}
+	if !client.CanRun("status") {
+		t.Error("status not permitted after authentication")
+	}
+}
@@ -0,0 +1,377 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+// ErrBatchNotExecuted is the result of batch operations following a failed one.
+var ErrBatchNotExecuted = errors.New("not executed, an earlier command in the batch failed")
+
+// ErrBatchNotRun is the result of batch operations before Batch.Run has been called.
+var ErrBatchNotRun = errors.New("batch has not been run yet")
+
+// ErrBatchAlreadyRun is returned by Batch.Run for a batch that has been run before.
+var ErrBatchAlreadyRun = errors.New("batch has already been run")
+
+// BatchError reports the operation of a batch that failed.
+type BatchError struct {
+	// the index of the failed operation in the batch
+	Index int
+
+	// the command of the failed operation, e.g. "setvol 30"
+	Command string
+
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch command #%d '%s' failed: %v", e.Index, e.Command, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchResult is the typed result of a batch operation, available after Batch.Run.
+type BatchResult[T any] struct {
+	value T
+	err   error
+}
+
+// Value returns the result of the operation, or the error that prevented it.
+func (r *BatchResult[T]) Value() (T, error) {
+	return r.value, r.err
+}
+
+// Err returns the error of the operation.
+func (r *BatchResult[T]) Err() error {
+	return r.err
+}
+
+type batchOp struct {
+	// the command of the operation, e.g. "setvol 30"
+	command string
+
+	// list queues the operation in a command list, returning a function
+	// that takes its result once MPD ran it. It is nil for operations that
+	// mpd.CommandList cannot express, which are run on their own instead.
+	list func(cl *mpd.CommandList) func()
+	run  func(client *ReconnectingClient) error
+
+	// fail records the error that prevented the operation
+	fail func(err error)
+}
+
+// Batch queues operations to be run in a single command list round trip.
+//
+//	batch := client.Batch()
+//	batch.Load("evening")
+//	batch.SetVolume(30)
+//	batch.Shuffle()
+//	batch.Play(0)
+//	status := batch.Status()
+//	err := batch.Run()
+//
+// MPD stops executing the command list at the first failing command. Run
+// then returns a *BatchError, and the results of the following operations
+// report ErrBatchNotExecuted.
+//
+// A batch is run only once; queue the next operations in a new batch.
+type Batch struct {
+	client *ReconnectingClient
+	ops    []*batchOp
+	ran    bool
+}
+
+// Batch returns a new, empty batch.
+func (c *ReconnectingClient) Batch() *Batch {
+	return &Batch{client: c}
+}
+
+// Len returns the number of queued operations.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+func newBatchResult[T any]() *BatchResult[T] {
+	return &BatchResult[T]{err: ErrBatchNotRun}
+}
+
+func (r *BatchResult[T]) fail(err error) {
+	r.err = err
+}
+
+// queue adds an operation without result value, which list adds to a command list.
+func (b *Batch) queue(command string, list func(cl *mpd.CommandList)) *BatchResult[struct{}] {
+	result := newBatchResult[struct{}]()
+	b.ops = append(b.ops, &batchOp{
+		command: command,
+		list: func(cl *mpd.CommandList) func() {
+			list(cl)
+			return func() { result.err = nil }
+		},
+		fail: result.fail,
+	})
+	return result
+}
+
+// queueAlone adds an operation without result value that is run on its own.
+// Arguments in command must already be quoted.
+func (b *Batch) queueAlone(command string) *BatchResult[struct{}] {
+	result := newBatchResult[struct{}]()
+	b.ops = append(b.ops, &batchOp{
+		command: command,
+		run: func(client *ReconnectingClient) error {
+			if err := client.Command("%s", mpd.Quoted(command)).OK(); err != nil {
+				return err
+			}
+			result.err = nil
+			return nil
+		},
+		fail: result.fail,
+	})
+	return result
+}
+
+// Play starts playing the song at position pos, or the current song if pos is negative.
+func (b *Batch) Play(pos int) *BatchResult[struct{}] {
+	command := "play"
+	if pos >= 0 {
+		command = fmt.Sprintf("play %d", pos)
+	}
+	return b.queue(command, func(cl *mpd.CommandList) { cl.Play(pos) })
+}
+
+// PlayID starts playing the song with the given id.
+func (b *Batch) PlayID(id int) *BatchResult[struct{}] {
+	return b.queue(fmt.Sprintf("playid %d", id), func(cl *mpd.CommandList) { cl.PlayID(id) })
+}
+
+// Pause pauses or resumes playback.
+func (b *Batch) Pause(pause bool) *BatchResult[struct{}] {
+	command := "pause 0"
+	if pause {
+		command = "pause 1"
+	}
+	return b.queue(command, func(cl *mpd.CommandList) { cl.Pause(pause) })
+}
+
+// Stop stops playback.
+func (b *Batch) Stop() *BatchResult[struct{}] {
+	return b.queue("stop", func(cl *mpd.CommandList) { cl.Stop() })
+}
+
+// Seek seeks to d within the song at position pos.
+//
+// Command lists only seek to whole seconds, so other positions are sought on their own.
+func (b *Batch) Seek(pos int, d time.Duration) *BatchResult[struct{}] {
+	command := fmt.Sprintf("seek %d %s", pos, formatSeconds(d))
+	if d%time.Second != 0 {
+		return b.queueAlone(command)
+	}
+	return b.queue(command, func(cl *mpd.CommandList) { cl.Seek(pos, int(d/time.Second)) })
+}
+
+// SeekCur seeks to d within the current song, or by d if relative is set.
+//
+// Command lists cannot seek within the current song, so it is run on its own.
+func (b *Batch) SeekCur(d time.Duration, relative bool) *BatchResult[struct{}] {
+	s := formatSeconds(d)
+	if relative && d >= 0 {
+		s = "+" + s
+	}
+	return b.queueAlone("seekcur " + s)
+}
+
+// SetVolume sets the volume to 0-100.
+func (b *Batch) SetVolume(volume int) *BatchResult[struct{}] {
+	return b.queue(fmt.Sprintf("setvol %d", volume), func(cl *mpd.CommandList) { cl.SetVolume(volume) })
+}
+
+// Add appends the song or directory uri to the queue.
+func (b *Batch) Add(uri string) *BatchResult[struct{}] {
+	return b.queue("add "+quote(uri), func(cl *mpd.CommandList) { cl.Add(uri) })
+}
+
+// AddID adds the song uri at position pos, or at the end if pos is negative,
+// and returns its song id.
+func (b *Batch) AddID(uri string, pos int) *BatchResult[int] {
+	command := "addid " + quote(uri)
+	if pos >= 0 {
+		command += " " + strconv.Itoa(pos)
+	}
+	result := newBatchResult[int]()
+	b.ops = append(b.ops, &batchOp{
+		command: command,
+		list: func(cl *mpd.CommandList) func() {
+			id := cl.AddID(uri, pos)
+			return func() { result.value, result.err = id.Value() }
+		},
+		fail: result.fail,
+	})
+	return result
+}
+
+// Clear removes all songs from the queue.
+func (b *Batch) Clear() *BatchResult[struct{}] {
+	return b.queue("clear", func(cl *mpd.CommandList) { cl.Clear() })
+}
+
+// Shuffle shuffles the queue.
+func (b *Batch) Shuffle() *BatchResult[struct{}] {
+	return b.queue("shuffle", func(cl *mpd.CommandList) { cl.Shuffle(-1, -1) })
+}
+
+// Load appends the stored playlist name to the queue.
+func (b *Batch) Load(name string) *BatchResult[struct{}] {
+	return b.queue("load "+quote(name), func(cl *mpd.CommandList) { cl.PlaylistLoad(name, -1, -1) })
+}
+
+// Status returns the status after the preceding operations of the batch.
+func (b *Batch) Status() *BatchResult[*Status] {
+	result := newBatchResult[*Status]()
+	b.ops = append(b.ops, &batchOp{
+		command: "status",
+		list: func(cl *mpd.CommandList) func() {
+			status := cl.Status()
+			return func() {
+				attrs, err := status.Value()
+				if result.err = err; err == nil {
+					result.value = ParseStatusAttrs(attrs)
+				}
+			}
+		},
+		fail: result.fail,
+	})
+	return result
+}
+
+// CurrentSong returns the current song after the preceding operations of the
+// batch, or nil if there is none.
+func (b *Batch) CurrentSong() *BatchResult[*PlaylistEntry] {
+	result := newBatchResult[*PlaylistEntry]()
+	b.ops = append(b.ops, &batchOp{
+		command: "currentsong",
+		list: func(cl *mpd.CommandList) func() {
+			currentSong := cl.CurrentSong()
+			return func() {
+				attrs, err := currentSong.Value()
+				if result.err = err; err == nil && len(attrs) > 0 {
+					result.value = ParsePlaylistEntryAttrs(attrs)
+					result.value.RequestedTags = b.client.requestedTags()
+				}
+			}
+		},
+		fail: result.fail,
+	})
+	return result
+}
+
+// PlaylistInfo returns the queue after the preceding operations of the batch.
+//
+// Command lists cannot return lists of songs, so it is run on its own.
+func (b *Batch) PlaylistInfo() *BatchResult[*Playlist] {
+	result := newBatchResult[*Playlist]()
+	b.ops = append(b.ops, &batchOp{
+		command: "playlistinfo",
+		run: func(client *ReconnectingClient) error {
+			attrsList, err := client.PlaylistInfo(-1, -1)
+			if err != nil {
+				return err
+			}
+			result.value, result.err = NewPlaylist(attrsList), nil
+			setRequestedTags(result.value.Entries, client.requestedTags())
+			return nil
+		},
+		fail: result.fail,
+	})
+	return result
+}
+
+// Run executes the queued operations via Do(), in a single command list on
+// the connection of the client.
+//
+// Operations that mpd.CommandList cannot express are run on their own,
+// between the command lists of the operations before and after them. No
+// other commands of the client run in between, but other MPD clients may.
+//
+// A batch is only run once; running it again returns ErrBatchAlreadyRun.
+func (b *Batch) Run() error {
+	if b.ran {
+		return ErrBatchAlreadyRun
+	}
+	b.ran = true
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	done := 0 // number of operations with results
+	err := b.client.Do(func(client *ReconnectingClient) error {
+		for done < len(b.ops) {
+			n, failed, err := runBatchOps(client, b.ops[done:])
+			var mpdErr mpd.Error
+			if err == nil {
+				done += n
+				continue
+			} else if !errors.As(err, &mpdErr) {
+				return err
+			}
+
+			failed += done
+			err = asAckError(err)
+			b.ops[failed].fail(err)
+			for _, op := range b.ops[failed+1:] {
+				op.fail(ErrBatchNotExecuted)
+			}
+			done = len(b.ops)
+			return &BatchError{Index: failed, Command: b.ops[failed].command, Err: err}
+		}
+		return nil
+	})
+	// nothing was executed, or the connection failed while running the operations
+	for _, op := range b.ops[done:] {
+		op.fail(err)
+	}
+	return err
+}
+
+// runBatchOps runs the first operations of ops: an operation that is run on
+// its own, or the operations up to the next such one as command list. It
+// returns the number of operations run and, if MPD failed one of them, its
+// index.
+func runBatchOps(client *ReconnectingClient, ops []*batchOp) (n, failed int, err error) {
+	if ops[0].run != nil {
+		return 1, 0, ops[0].run(client)
+	}
+
+	cl := client.BeginCommandList()
+	var takes []func()
+	for n < len(ops) && ops[n].list != nil {
+		takes = append(takes, ops[n].list(cl))
+		n++
+	}
+	err = cl.End()
+	failed = n
+	var mpdErr mpd.Error
+	if errors.As(err, &mpdErr) {
+		if failed = mpdErr.CommandListIndex; failed < 0 || failed >= n {
+			failed = 0
+		}
+	} else if err != nil {
+		return n, 0, err
+	}
+	for _, take := range takes[:failed] {
+		take()
+	}
+	return n, failed, err
+}
+
+// formatSeconds formats d as fractional seconds, as expected by the seek commands.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
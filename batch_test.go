@@ -0,0 +1,119 @@
+package mmpd_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+)
+
+func TestBatch(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	batch := client.Batch()
+	batch.Add("a")
+	id := batch.AddID("b/1.flac", 0)
+	batch.SetVolume(30)
+	status := batch.Status()
+	playlist := batch.PlaylistInfo()
+	if err := batch.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := id.Value(); err != nil {
+		t.Errorf("addid: %v", err)
+	}
+	if s, err := status.Value(); err != nil || s.Volume != 30 || s.PlaylistLength != 4 {
+		t.Errorf("status: %+v, %v", s, err)
+	}
+	if p, err := playlist.Value(); err != nil || len(p.Entries) != 4 || p.Entries[0].File != "b/1.flac" {
+		t.Errorf("playlist: %+v, %v", p, err)
+	}
+}
+
+func TestBatchFailure(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	batch := client.Batch()
+	added := batch.Add("a")
+	failed := batch.Add("missing")
+	skipped := batch.SetVolume(30)
+	err := batch.Run()
+
+	var batchErr *mmpd.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, mmpd.ErrAckNoExist) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if added.Err() != nil || !errors.Is(failed.Err(), mmpd.ErrAckNoExist) || !errors.Is(skipped.Err(), mmpd.ErrBatchNotExecuted) {
+		t.Errorf("results: %v, %v, %v", added.Err(), failed.Err(), skipped.Err())
+	}
+}
+
+func TestBatchRunsOnClientConnection(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	// no other connection is needed
+	srv.SetAcceptConnections(false)
+	batch := client.Batch()
+	result := batch.SetVolume(30)
+	if err := batch.Run(); err != nil || result.Err() != nil {
+		t.Fatalf("batch failed: %v, %v", err, result.Err())
+	}
+	if n := srv.Connections(); n != 1 {
+		t.Errorf("%d connections", n)
+	}
+
+	if err := batch.Run(); !errors.Is(err, mmpd.ErrBatchAlreadyRun) {
+		t.Errorf("second run: %v", err)
+	}
+}
+
+func TestBatchOperationsRunAlone(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv, mmpd.WithTagTypes(mmpd.TagTitle))
+
+	batch := client.Batch()
+	batch.Add("a")
+	batch.Play(0)
+	seek := batch.SeekCur(1500*time.Millisecond, false)
+	playlist := batch.PlaylistInfo()
+	currentSong := batch.CurrentSong()
+	failed := batch.Add("missing")
+	skipped := batch.SetVolume(30)
+	err := batch.Run()
+
+	var batchErr *mmpd.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 5 || batchErr.Command != `add "missing"` || !errors.Is(err, mmpd.ErrAckNoExist) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if seek.Err() != nil || !errors.Is(failed.Err(), mmpd.ErrAckNoExist) || !errors.Is(skipped.Err(), mmpd.ErrBatchNotExecuted) {
+		t.Errorf("results: %v, %v, %v", seek.Err(), failed.Err(), skipped.Err())
+	}
+
+	// songs carry only the tags the client negotiated
+	p, err := playlist.Value()
+	if err != nil || len(p.Entries) != 3 {
+		t.Fatalf("playlist: %+v, %v", p, err)
+	}
+	if entry := p.Entries[0]; entry.Title != "One" || entry.Album != "" || len(entry.RequestedTags) != 1 {
+		t.Errorf("playlist entry %+v", entry)
+	}
+	if song, err := currentSong.Value(); err != nil || song == nil || song.Title != "One" || song.Album != "" || len(song.RequestedTags) != 1 {
+		t.Errorf("current song: %+v, %v", song, err)
+	}
+
+	// the operations around the ones run alone are sent as command lists
+	var lists int
+	for _, line := range srv.Received() {
+		if line == "command_list_ok_begin" {
+			lists++
+		}
+	}
+	if lists != 2 {
+		t.Errorf("%d command lists in %v", lists, srv.Received())
+	}
+}
@@ -0,0 +1,258 @@
+package mmpd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/linkdata/deadlock"
+)
+
+// greetingTimeout is how long the bridge waits for MPD to greet a new
+// connection and accept its password before giving up on it.
+var greetingTimeout = 10 * time.Second
+
+// pairingTimeout is how long a connection dialed by prepare waits for the
+// client it was dialed for.
+var pairingTimeout = 10 * time.Second
+
+// errPairingToken is returned for connections to the bridge that do not
+// present the pairing token.
+var errPairingToken = errors.New("wrong pairing token")
+
+// bridge connects clients to MPD connections made with dial.
+//
+// mpd.Client can only dial a network address itself, so connections that
+// are recorded or use another transport are made to the bridge instead. For
+// every connection, prepare dials and authenticates with MPD, and opens a
+// loopback listener for the client. The client presents a random pairing
+// token as its password; other connections to the listener are refused, and
+// it is closed once the client connected.
+type bridge struct {
+	dial func() (net.Conn, error)
+
+	lock    deadlock.Mutex
+	closers map[io.Closer]struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newBridge(dial func() (net.Conn, error)) *bridge {
+	return &bridge{
+		dial:    dial,
+		closers: make(map[io.Closer]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// prepare dials MPD and authenticates with password for the next
+// connection, so errors are returned to the client rather than showing up
+// as a connection closed before the greeting. It returns the address to
+// connect to and the token to send as password.
+func (b *bridge) prepare(password string) (string, string, error) {
+	upstream, err := b.dial()
+	if err != nil {
+		return "", "", err
+	}
+	greeting, err := handshake(upstream, password)
+	if err != nil {
+		return "", "", err
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		_ = upstream.Close()
+		return "", "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = upstream.Close()
+		return "", "", err
+	}
+	if !b.startServing(listener, upstream) {
+		return "", "", net.ErrClosed
+	}
+	go b.serve(listener, upstream, greeting, token)
+	return listener.Addr().String(), token, nil
+}
+
+// handshake reads the greeting of upstream and authenticates with password,
+// unless it takes longer than greetingTimeout. upstream is closed on errors.
+func handshake(upstream net.Conn, password string) (string, error) {
+	if err := upstream.SetDeadline(time.Now().Add(greetingTimeout)); err != nil {
+		_ = upstream.Close()
+		return "", err
+	}
+	rc, err := newRawConn(upstream, password)
+	if err != nil {
+		return "", err
+	}
+	if err := upstream.SetDeadline(time.Time{}); err != nil {
+		_ = rc.close()
+		return "", err
+	}
+	return "OK MPD " + rc.version, nil
+}
+
+// serve waits for the connection presenting token and forwards it to
+// upstream. If there is none within pairingTimeout, upstream is closed.
+func (b *bridge) serve(listener net.Listener, upstream net.Conn, greeting, token string) {
+	defer b.wg.Done()
+
+	paired := make(chan net.Conn)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.pair(conn, greeting, token, paired, stop)
+		}
+	}()
+
+	timer := time.NewTimer(pairingTimeout)
+	var conn net.Conn
+	select {
+	case conn = <-paired:
+	case <-timer.C:
+		fmt.Printf("mpd: no connection to the bridge within %v\n", pairingTimeout)
+	case <-b.done:
+	}
+	timer.Stop()
+	close(stop)
+	_ = listener.Close()
+	b.untrack(listener)
+	if conn == nil {
+		_ = upstream.Close()
+		b.untrack(upstream)
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	copyAndClose := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		_ = dst.Close()
+		_ = src.Close()
+		done <- struct{}{}
+	}
+	go copyAndClose(upstream, conn)
+	go copyAndClose(conn, upstream)
+	<-done
+	<-done
+
+	b.untrack(conn, upstream)
+}
+
+// pair greets conn and checks that it presents token, passing it to paired
+// if it does. Other connections are refused.
+func (b *bridge) pair(conn net.Conn, greeting, token string, paired chan<- net.Conn, stop <-chan struct{}) {
+	if !b.track(conn) {
+		return
+	}
+	if err := checkToken(conn, greeting, token); err != nil {
+		fmt.Printf("mpd: refusing connection to the bridge from %s: %v\n", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		b.untrack(conn)
+		return
+	}
+	select {
+	case paired <- conn:
+	case <-stop:
+		_ = conn.Close()
+		b.untrack(conn)
+	}
+}
+
+// checkToken sends greeting to conn and expects the password command with
+// token in return, unless it takes longer than pairingTimeout.
+func checkToken(conn net.Conn, greeting, token string) error {
+	if err := conn.SetDeadline(time.Now().Add(pairingTimeout)); err != nil {
+		return err
+	}
+	// not closed, as that would close conn
+	text := textproto.NewConn(conn)
+	if err := text.PrintfLine("%s", greeting); err != nil {
+		return err
+	}
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(line), []byte("password "+quote(token))) != 1 {
+		_ = text.PrintfLine("ACK [%d@0] {password} incorrect password", AckPassword)
+		return errPairingToken
+	}
+	if err := text.PrintfLine("OK"); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// track registers conn so close can sever it, unless the bridge is closed
+// already.
+func (b *bridge) track(conn net.Conn) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closers == nil {
+		_ = conn.Close()
+		return false
+	}
+	b.closers[conn] = struct{}{}
+	return true
+}
+
+// startServing registers listener and upstream like track, and the serving
+// for close to wait for.
+func (b *bridge) startServing(listener net.Listener, upstream net.Conn) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closers == nil {
+		_ = listener.Close()
+		_ = upstream.Close()
+		return false
+	}
+	b.closers[listener] = struct{}{}
+	b.closers[upstream] = struct{}{}
+	b.wg.Add(1)
+	return true
+}
+
+func (b *bridge) untrack(closers ...io.Closer) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, closer := range closers {
+		delete(b.closers, closer)
+	}
+}
+
+// close closes the listeners, severs the forwarded connections and waits
+// for the forwarding goroutines. Dials in progress are not waited for, their
+// connections are closed when they complete.
+func (b *bridge) close() {
+	b.lock.Lock()
+	if b.closers == nil {
+		b.lock.Unlock()
+		return
+	}
+	for closer := range b.closers {
+		_ = closer.Close()
+	}
+	b.closers = nil
+	close(b.done)
+	b.lock.Unlock()
+
+	b.wg.Wait()
+}
@@ -0,0 +1,128 @@
+package mmpd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// greetingServer accepts one connection, greets it and answers every
+// command with OK. The commands are sent to received.
+func greetingServer(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	commands := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.WriteString(conn, "OK MPD 0.23.5\n")
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			commands <- scanner.Text()
+			_, _ = io.WriteString(conn, "OK\n")
+		}
+	}()
+	return listener.Addr().String(), commands
+}
+
+func TestBridgeGreetingTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { greetingTimeout = timeout }(greetingTimeout)
+	greetingTimeout = 50 * time.Millisecond
+
+	// a server that accepts connections, but never greets
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := silent.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	b := newBridge(func() (net.Conn, error) {
+		return net.Dial("tcp", silent.Addr().String())
+	})
+	defer b.close()
+	var netErr net.Error
+	if _, _, err := b.prepare(""); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	_ = (<-accepted).Close()
+}
+
+func TestBridgeRefusesStrayConnection(t *testing.T) {
+	upstream, received := greetingServer(t)
+	b := newBridge(func() (net.Conn, error) {
+		return net.Dial("tcp", upstream)
+	})
+	defer b.close()
+
+	addr, token, err := b.prepare("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != `password "secret"` {
+		t.Errorf("MPD received %q, want the password", got)
+	}
+
+	// a connection without the token is refused, and does not use up the
+	// connection to MPD
+	for _, first := range []string{"status", `password "guess"`} {
+		stray, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if greeting, err := stray.ReadLine(); err != nil || greeting != "OK MPD 0.23.5" {
+			t.Fatalf("greeting %q, error %v", greeting, err)
+		}
+		if err := stray.PrintfLine("%s", first); err != nil {
+			t.Fatal(err)
+		}
+		if line, err := stray.ReadLine(); err != nil || line != "ACK [3@0] {password} incorrect password" {
+			t.Errorf("%s: got %q, error %v", first, line, err)
+		}
+		if _, err := stray.ReadLine(); err != io.EOF {
+			t.Errorf("%s: got %v, want the connection closed", first, err)
+		}
+		_ = stray.Close()
+	}
+
+	rc, err := dialRaw("tcp", addr, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.close()
+	if rc.version != "0.23.5" {
+		t.Errorf("version %q", rc.version)
+	}
+	if err := rc.command("ping"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.readOK(); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "ping" {
+		t.Errorf("MPD received %q, want the ping", got)
+	}
+
+	// the listener is closed once the client connected
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		_ = conn.Close()
+		t.Error("second connection to the bridge accepted")
+	}
+}
@@ -68,7 +68,7 @@ func (cc *ClientCache) Shutdown() {
 	defer cc.clientLock.Unlock()
 
 	for _, cce := range cc.clients {
-		_ = cce.Client.Close()
+		_ = cce.ReconnectingClient.Close()
 	}
 
 	clear(cc.clients)
@@ -0,0 +1,55 @@
+package mmpd_test
+
+import (
+	"testing"
+
+	"github.com/mkke/mmpd"
+)
+
+func TestClientCache(t *testing.T) {
+	srv1, srv2 := startServer(t), startServer(t)
+	cache := mmpd.NewClientCache()
+
+	a, err := cache.GetOrCreate(srv1.Network(), srv1.Addr(), mmpd.WithBlocking(), mmpd.WithKeepalive(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.GetOrCreate(srv1.Network(), srv1.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("second client for the same address")
+	}
+	other, err := cache.GetOrCreate(srv2.Network(), srv2.Addr(), mmpd.WithBlocking(), mmpd.WithKeepalive(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == a {
+		t.Error("same client for another address")
+	}
+	for _, entry := range []*mmpd.ClientCacheEntry{a, other} {
+		if err := entry.Do(mmpd.Ping); err != nil {
+			t.Error(err)
+		}
+	}
+
+	cache.Shutdown()
+	for _, entry := range []*mmpd.ClientCacheEntry{a, other} {
+		select {
+		case <-entry.Done():
+		default:
+			t.Errorf("client for %v not closed", entry.NetAddr)
+		}
+	}
+	eventually(t, "disconnect", func() bool { return srv1.Connections() == 0 && srv2.Connections() == 0 })
+
+	c, err := cache.GetOrCreate(srv1.Network(), srv1.Addr(), mmpd.WithBlocking(), mmpd.WithKeepalive(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c == a {
+		t.Error("closed client returned after shutdown")
+	}
+}
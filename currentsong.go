@@ -3,9 +3,9 @@ package mmpd
 import "fmt"
 
 type CurrentSong struct {
-	PreviousSong *PlaylistEntry
-	CurrentSong  *PlaylistEntry
-	NextSong     *PlaylistEntry
+	PreviousSong *PlaylistEntry `json:"previous_song,omitempty"`
+	CurrentSong  *PlaylistEntry `json:"current_song,omitempty"`
+	NextSong     *PlaylistEntry `json:"next_song,omitempty"`
 }
 
 func NewCurrentSong(status *Status, playlist *Playlist) *CurrentSong {
@@ -0,0 +1,140 @@
+package mmpd
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+// testPlaylistAttrs returns the playlistinfo attributes of a queue of n songs.
+func testPlaylistAttrs(n int) []mpd.Attrs {
+	attrsList := make([]mpd.Attrs, n)
+	for i := range attrsList {
+		attrsList[i] = mpd.Attrs{
+			"file":          fmt.Sprintf("artist%d/album%d/%02d.flac", i/100, i/10, i%10+1),
+			"Artist":        fmt.Sprintf("Artist %d", i/100),
+			"AlbumArtist":   fmt.Sprintf("Artist %d", i/100),
+			"Album":         fmt.Sprintf("Album %d", i/10),
+			"Title":         fmt.Sprintf("Title %d", i),
+			"Track":         strconv.Itoa(i%10 + 1),
+			"Disc":          "1/1",
+			"Date":          "2024",
+			"Genre":         "Rock",
+			"Format":        "44100:16:2",
+			"Last-Modified": "2024-05-01T10:00:00Z",
+			"duration":      "215.373",
+			"Time":          "215",
+			"Pos":           strconv.Itoa(i),
+			"Id":            strconv.Itoa(i + 1),
+		}
+	}
+	return attrsList
+}
+
+func testStatusAttrs() mpd.Attrs {
+	return mpd.Attrs{
+		"volume": "50", "repeat": "0", "random": "1", "single": "0", "consume": "0",
+		"playlist": "42", "playlistlength": "50000", "state": "play",
+		"song": "1234", "songid": "1235", "nextsong": "1235", "nextsongid": "1236",
+		"time": "10:215", "elapsed": "10.123", "duration": "215.373", "bitrate": "1411",
+		"audio": "44100:16:2", "mixrampdb": "0.000000",
+	}
+}
+
+func TestPlaylistEntryEquals(t *testing.T) {
+	a, b := NewPlaylist(testPlaylistAttrs(3)), NewPlaylist(testPlaylistAttrs(3))
+	for i := range a.Entries {
+		if !a.Entries[i].Equals(b.Entries[i]) {
+			t.Errorf("entry %d differs from its copy", i)
+		}
+	}
+	if a.Entries[0].Equals(b.Entries[1]) {
+		t.Error("different entries are equal")
+	}
+
+	b.Entries[2].RequestedTags = []Tag{TagTitle}
+	if a.Entries[2].Equals(b.Entries[2]) {
+		t.Error("entries with different requested tags are equal")
+	}
+	if (*PlaylistEntry)(nil).Equals(a.Entries[0]) || !(*PlaylistEntry)(nil).Equals(nil) {
+		t.Error("unexpected nil comparison")
+	}
+}
+
+func TestStatusDiff(t *testing.T) {
+	a, b := ParseStatusAttrs(testStatusAttrs()), ParseStatusAttrs(testStatusAttrs())
+	if changed := a.Diff(b); changed != 0 || !a.Equals(b) {
+		t.Errorf("copies differ in %v", changed)
+	}
+
+	b.Volume = 30
+	b.Elapsed = 11
+	if changed := a.Diff(b); changed != StatusVolume|StatusElapsed || a.Equals(b) {
+		t.Errorf("changed %v", changed)
+	}
+	if changed := a.Diff(nil); changed != AllStatusFields {
+		t.Errorf("changed %v from nil", changed)
+	}
+}
+
+func BenchmarkNewPlaylist50k(b *testing.B) {
+	attrsList := testPlaylistAttrs(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewPlaylist(attrsList)
+	}
+}
+
+// BenchmarkPlaylistEntryEquals50k compares all entries of a 50k queue, like
+// finding the entries changed by a reload.
+func BenchmarkPlaylistEntryEquals50k(b *testing.B) {
+	attrsList := testPlaylistAttrs(50000)
+	x, y := NewPlaylist(attrsList), NewPlaylist(attrsList)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for idx, entry := range x.Entries {
+			if !entry.Equals(y.Entries[idx]) {
+				b.Fatal("entries differ")
+			}
+		}
+	}
+}
+
+func BenchmarkStatusDiff(b *testing.B) {
+	x, y := ParseStatusAttrs(testStatusAttrs()), ParseStatusAttrs(testStatusAttrs())
+	y.Elapsed++
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if x.Diff(y) != StatusElapsed {
+			b.Fatal("unexpected diff")
+		}
+	}
+}
+
+func BenchmarkCurrentSongEquals(b *testing.B) {
+	playlist := NewPlaylist(testPlaylistAttrs(50000))
+	status := ParseStatusAttrs(testStatusAttrs())
+	x := &CurrentSong{PreviousSong: playlist.Entries[status.Song-1], CurrentSong: playlist.Entries[status.Song], NextSong: playlist.Entries[status.NextSong]}
+	y := *x
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !x.Equals(&y) {
+			b.Fatal("current songs differ")
+		}
+	}
+}
+
+// BenchmarkWithChanges50k applies a plchanges response of a few entries to a
+// 50k queue.
+func BenchmarkWithChanges50k(b *testing.B) {
+	playlist := NewPlaylist(testPlaylistAttrs(50000))
+	changed := NewPlaylist(testPlaylistAttrs(50000)[100:110]).Entries
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if playlist.withChanges(changed, len(playlist.Entries)) == nil {
+			b.Fatal("changes not applied")
+		}
+	}
+}
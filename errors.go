@@ -0,0 +1,176 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"syscall"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+// AckCode is the error code of an MPD ACK response.
+type AckCode int
+
+// Error codes as defined in MPD's src/protocol/Ack.hxx.
+const (
+	AckNotList       AckCode = 1
+	AckArg           AckCode = 2
+	AckPassword      AckCode = 3
+	AckPermission    AckCode = 4
+	AckUnknown       AckCode = 5
+	AckNoExist       AckCode = 50
+	AckPlaylistMax   AckCode = 51
+	AckSystem        AckCode = 52
+	AckPlaylistLoad  AckCode = 53
+	AckUpdateAlready AckCode = 54
+	AckPlayerSync    AckCode = 55
+	AckExist         AckCode = 56
+)
+
+func (c AckCode) String() string {
+	switch c {
+	case AckNotList:
+		return "ACK_ERROR_NOT_LIST"
+	case AckArg:
+		return "ACK_ERROR_ARG"
+	case AckPassword:
+		return "ACK_ERROR_PASSWORD"
+	case AckPermission:
+		return "ACK_ERROR_PERMISSION"
+	case AckUnknown:
+		return "ACK_ERROR_UNKNOWN"
+	case AckNoExist:
+		return "ACK_ERROR_NO_EXIST"
+	case AckPlaylistMax:
+		return "ACK_ERROR_PLAYLIST_MAX"
+	case AckSystem:
+		return "ACK_ERROR_SYSTEM"
+	case AckPlaylistLoad:
+		return "ACK_ERROR_PLAYLIST_LOAD"
+	case AckUpdateAlready:
+		return "ACK_ERROR_UPDATE_ALREADY"
+	case AckPlayerSync:
+		return "ACK_ERROR_PLAYER_SYNC"
+	case AckExist:
+		return "ACK_ERROR_EXIST"
+	default:
+		return fmt.Sprintf("ACK_ERROR_%d", int(c))
+	}
+}
+
+// AckError is an error response of MPD:
+//
+//	ACK [Code@CommandListIndex] {Command} Message
+//
+// It unwraps to the equivalent mpd.Error, and matches the Err* sentinels
+// below with errors.Is by its code.
+type AckError struct {
+	Code AckCode
+
+	// the index of the failing command in a command list, 0 otherwise
+	CommandListIndex int
+
+	// the name of the failing command
+	Command string
+
+	Message string
+}
+
+func (e *AckError) Error() string {
+	if e.Command != "" {
+		return fmt.Sprintf("command '%s' failed: %s (%s)", e.Command, e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// Is matches any *AckError with the same code.
+func (e *AckError) Is(target error) bool {
+	if t, ok := target.(*AckError); ok {
+		return t.Code == e.Code
+	}
+	return false
+}
+
+// Unwrap returns the error as mpd.Error, for callers matching that type.
+func (e *AckError) Unwrap() error {
+	return mpd.Error{
+		Code:             mpd.ErrorCode(e.Code),
+		CommandListIndex: e.CommandListIndex,
+		CommandName:      e.Command,
+		Message:          e.Message,
+	}
+}
+
+// Sentinels for matching AckErrors with errors.Is.
+var (
+	ErrAckNotList       = &AckError{Code: AckNotList}
+	ErrAckArg           = &AckError{Code: AckArg}
+	ErrAckPassword      = &AckError{Code: AckPassword}
+	ErrAckPermission    = &AckError{Code: AckPermission}
+	ErrAckUnknown       = &AckError{Code: AckUnknown}
+	ErrAckNoExist       = &AckError{Code: AckNoExist}
+	ErrAckPlaylistMax   = &AckError{Code: AckPlaylistMax}
+	ErrAckSystem        = &AckError{Code: AckSystem}
+	ErrAckPlaylistLoad  = &AckError{Code: AckPlaylistLoad}
+	ErrAckUpdateAlready = &AckError{Code: AckUpdateAlready}
+	ErrAckPlayerSync    = &AckError{Code: AckPlayerSync}
+	ErrAckExist         = &AckError{Code: AckExist}
+)
+
+// asAckError converts an mpd.Error returned by the embedded mpd.Client to an
+// *AckError. Other errors are returned unchanged.
+func asAckError(err error) error {
+	if mpdErr, ok := err.(mpd.Error); ok {
+		return &AckError{
+			Code:             AckCode(mpdErr.Code),
+			CommandListIndex: mpdErr.CommandListIndex,
+			Command:          mpdErr.CommandName,
+			Message:          mpdErr.Message,
+		}
+	}
+	return err
+}
+
+// IsTransient reports whether err is a connection-level failure, after which
+// the connection is unusable and a reconnect may succeed.
+//
+// ACK responses are never transient: the connection is fine, and repeating
+// the command would fail the same way.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var ackErr *AckError
+	var mpdErr mpd.Error
+	if errors.As(err, &ackErr) || errors.As(err, &mpdErr) {
+		return false
+	}
+
+	var netErr net.Error
+	var protoErr textproto.ProtocolError
+	switch {
+	case errors.Is(err, ErrNotConnected),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		errors.As(err, &netErr),
+		// a response we cannot parse leaves the connection out of sync
+		errors.As(err, &protoErr):
+		return true
+	default:
+		return false
+	}
+}
+
+// IsPermanent reports whether err is a failure that a reconnect would not fix,
+// like a bad argument or a missing song.
+func IsPermanent(err error) bool {
+	return err != nil && !IsTransient(err)
+}
@@ -0,0 +1,88 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"syscall"
+	"testing"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+func TestParseAck(t *testing.T) {
+	tests := []struct {
+		line string
+		want AckError
+	}{
+		{`ACK [50@0] {lsinfo} No such directory`,
+			AckError{Code: AckNoExist, Command: "lsinfo", Message: "No such directory"}},
+		{`ACK [2@3] {setvol} Invalid volume value`,
+			AckError{Code: AckArg, CommandListIndex: 3, Command: "setvol", Message: "Invalid volume value"}},
+		{`ACK [5@0] {} unknown command "foo"`,
+			AckError{Code: AckUnknown, Message: `unknown command "foo"`}},
+		{`ACK [4@0] {play} you don't have permission for "play"`,
+			AckError{Code: AckPermission, Command: "play", Message: `you don't have permission for "play"`}},
+		// braces and brackets in the message
+		{`ACK [50@0] {add} No such song "a} b/[1] c.flac"`,
+			AckError{Code: AckNoExist, Command: "add", Message: `No such song "a} b/[1] c.flac"`}},
+		{`ACK [52@1] {load} {x} ] [y@z] `,
+			AckError{Code: AckSystem, CommandListIndex: 1, Command: "load", Message: "{x} ] [y@z]"}},
+		// malformed headers leave the rest as message
+		{`ACK no header at all`,
+			AckError{Message: "no header at all"}},
+		{`ACK [50] {find} user@host`,
+			AckError{Message: "[50] {find} user@host"}},
+		{`ACK [x@y] {find} bad numbers`,
+			AckError{Command: "find", Message: "bad numbers"}},
+		{`ACK [56@0] {save`,
+			AckError{Code: AckExist, Message: "{save"}},
+		{`ACK [56@0]`,
+			AckError{Message: "[56@0]"}},
+	}
+	for _, test := range tests {
+		var ackErr *AckError
+		if err := parseAck(test.line); !errors.As(err, &ackErr) {
+			t.Errorf("%s: got %v", test.line, err)
+		} else if *ackErr != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.line, *ackErr, test.want)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	ackErr := &AckError{Code: AckNoExist, Command: "add", Message: "No such song"}
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"nil", nil, false},
+		{"ack", ackErr, false},
+		{"wrapped ack", fmt.Errorf("queue: %w", ackErr), false},
+		{"batch ack", &BatchError{Index: 1, Command: "add", Err: ackErr}, false},
+		{"mpd error", mpd.Error{Code: mpd.ErrorCode(AckSystem), Message: "failed"}, false},
+		{"permission", ErrAckPermission, false},
+		{"closed client", ErrClosed, false},
+		{"other", errors.New("other"), false},
+		{"not connected", ErrNotConnected, true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"closed connection", net.ErrClosed, true},
+		{"reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{"refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"protocol", textproto.ProtocolError("can't parse line: x"), true},
+		{"batch eof", &BatchError{Index: 0, Command: "status", Err: io.EOF}, true},
+	}
+	for _, test := range tests {
+		if got := IsTransient(test.err); got != test.transient {
+			t.Errorf("%s: IsTransient is %v", test.name, got)
+		}
+		if got := IsPermanent(test.err); got != (test.err != nil && !test.transient) {
+			t.Errorf("%s: IsPermanent is %v", test.name, got)
+		}
+	}
+}
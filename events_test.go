@@ -0,0 +1,77 @@
+package mmpd_test
+
+import (
+	"testing"
+
+	"github.com/mkke/mmpd"
+)
+
+func TestListenersFire(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	events := make(chan string, 20)
+	client.ConnectedListeners.Add(mmpd.NewConnectedListener(func(*mmpd.ReconnectingClient) {
+		events <- "connected"
+	}))
+	client.DisconnectedListeners.Add(mmpd.NewDisconnectedListener(func(*mmpd.ReconnectingClient) {
+		events <- "disconnected"
+	}))
+	statuses := make(chan *mmpd.Status, 10)
+	client.StatusChangedListeners.Add(mmpd.NewStatusChangedListener(func(_ *mmpd.ReconnectingClient, status *mmpd.Status) {
+		statuses <- status
+	}))
+	playlists := make(chan *mmpd.Playlist, 10)
+	client.PlaylistChangedListeners.Add(mmpd.NewPlaylistChangedListener(func(_ *mmpd.ReconnectingClient, playlist *mmpd.Playlist) {
+		playlists <- playlist
+	}))
+	currentSongs := make(chan *mmpd.CurrentSong, 10)
+	client.CurrentSongChangedListeners.Add(mmpd.NewCurrentSongChangedListener(func(_ *mmpd.ReconnectingClient, currentSong *mmpd.CurrentSong) {
+		currentSongs <- currentSong
+	}))
+
+	exec(t, srv, `add "a"`, "play 1")
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if status := receive(t, statuses); status.State != mmpd.Play || status.Song != 1 {
+		t.Errorf("status %+v", status)
+	}
+	if playlist := receive(t, playlists); len(playlist.Entries) != 3 {
+		t.Errorf("playlist %+v", playlist)
+	}
+	if currentSong := receive(t, currentSongs); currentSong.CurrentSong == nil || currentSong.CurrentSong.File != "a/2.flac" ||
+		currentSong.PreviousSong == nil || currentSong.PreviousSong.File != "a/1.flac" ||
+		currentSong.NextSong == nil || currentSong.NextSong.File != "a/3.flac" {
+		t.Errorf("current song %+v", currentSong)
+	}
+
+	// nothing changed, nothing to report
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	exec(t, srv, "next")
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if status := receive(t, statuses); status.Song != 2 {
+		t.Errorf("status after next %+v", status)
+	}
+	if currentSong := receive(t, currentSongs); currentSong.CurrentSong == nil || currentSong.CurrentSong.File != "a/3.flac" {
+		t.Errorf("current song after next %+v", currentSong)
+	}
+	select {
+	case playlist := <-playlists:
+		t.Errorf("unchanged playlist reported: %+v", playlist)
+	default:
+	}
+
+	srv.DisconnectAll()
+	_ = client.Do(mmpd.Ping)
+	if event := receive(t, events); event != "disconnected" {
+		t.Errorf("got %s, want disconnected", event)
+	}
+	if event := receive(t, events); event != "connected" {
+		t.Errorf("got %s, want connected", event)
+	}
+}
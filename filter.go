@@ -0,0 +1,577 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+// ErrEmptyFilter is returned for filters MPD cannot express, like And()
+// without filters.
+var ErrEmptyFilter = errors.New("empty filter")
+
+// ErrInvalidPosition is returned for WithPosition values that are neither an
+// absolute nor a relative position.
+var ErrInvalidPosition = errors.New("invalid position")
+
+var positionRegexp = regexp.MustCompile(`^[+-]?[0-9]+$`)
+
+// Filter is a MPD filter expression as used by find, search and related commands.
+//
+// Filters are built with the constructor functions of this package and render
+// to the syntax described in https://mpd.readthedocs.io/en/latest/protocol.html#filters.
+type Filter interface {
+	// String returns the filter expression in MPD syntax.
+	String() string
+
+	appendTo(b *strings.Builder)
+
+	// match evaluates the filter locally, e.g. for a LibraryIndex.
+	match(entry *PlaylistEntry, foldCase bool) bool
+}
+
+type tagFilter struct {
+	tag   Tag
+	op    string
+	value string
+
+	regexOnce sync.Once
+	regex     *regexp.Regexp
+	foldRegex *regexp.Regexp
+}
+
+func (f *tagFilter) appendTo(b *strings.Builder) {
+	b.WriteByte('(')
+	b.WriteString(string(f.tag))
+	b.WriteByte(' ')
+	b.WriteString(f.op)
+	b.WriteByte(' ')
+	appendQuoted(b, f.value)
+	b.WriteByte(')')
+}
+
+func (f *tagFilter) String() string {
+	return filterString(f)
+}
+
+func (f *tagFilter) match(entry *PlaylistEntry, foldCase bool) bool {
+	if f.tag == TagAny {
+		for _, tag := range anyTags {
+			if f.matchValue(entry.TagValue(tag), foldCase) {
+				return true
+			}
+		}
+		return false
+	}
+	return f.matchValue(entry.TagValue(f.tag), foldCase)
+}
+
+func (f *tagFilter) matchValue(value string, foldCase bool) bool {
+	switch f.op {
+	case "==":
+		return equalValues(value, f.value, foldCase)
+	case "!=":
+		return !equalValues(value, f.value, foldCase)
+	case "contains":
+		if foldCase {
+			return strings.Contains(strings.ToLower(value), strings.ToLower(f.value))
+		}
+		return strings.Contains(value, f.value)
+	case "starts_with":
+		if foldCase {
+			return strings.HasPrefix(strings.ToLower(value), strings.ToLower(f.value))
+		}
+		return strings.HasPrefix(value, f.value)
+	case "=~", "!~":
+		var matched bool
+		if f.tag == "AudioFormat" {
+			matched = matchAudioFormatMask(value, f.value)
+		} else if regex := f.compiled(foldCase); regex != nil {
+			matched = regex.MatchString(value)
+		}
+		return matched == (f.op == "=~")
+	default:
+		return false
+	}
+}
+
+// compiled returns the regular expression of a =~ or !~ filter, or nil if
+// it is not valid Go syntax.
+func (f *tagFilter) compiled(foldCase bool) *regexp.Regexp {
+	f.regexOnce.Do(func() {
+		f.regex, _ = regexp.Compile(f.value)
+		f.foldRegex, _ = regexp.Compile("(?i)" + f.value)
+	})
+	if foldCase {
+		return f.foldRegex
+	}
+	return f.regex
+}
+
+func equalValues(a, b string, foldCase bool) bool {
+	if foldCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// matchAudioFormatMask matches a "samplerate:bits:channels" format against
+// a mask where each component may be "*".
+func matchAudioFormatMask(format, mask string) bool {
+	formatParts := strings.Split(format, ":")
+	maskParts := strings.Split(mask, ":")
+	if len(formatParts) != len(maskParts) {
+		return false
+	}
+	for idx, part := range maskParts {
+		if part != "*" && part != formatParts[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// anyTags are the tags matched by TagAny.
+var anyTags = []Tag{
+	TagArtist, TagArtistSort, TagAlbum, TagAlbumSort, TagAlbumArtist, TagAlbumArtistSort,
+	TagTitle, TagTitleSort, TagTrack, TagName, TagGenre, TagMood, TagDate, TagOriginalDate,
+	TagComposer, TagComposerSort, TagPerformer, TagConductor, TagWork, TagEnsemble,
+	TagMovement, TagMovementNumber, TagLocation, TagGrouping, TagComment, TagDisc, TagLabel,
+}
+
+type keywordFilter struct {
+	keyword string
+	value   string
+}
+
+func (f *keywordFilter) appendTo(b *strings.Builder) {
+	b.WriteByte('(')
+	b.WriteString(f.keyword)
+	b.WriteByte(' ')
+	appendQuoted(b, f.value)
+	b.WriteByte(')')
+}
+
+func (f *keywordFilter) String() string {
+	return filterString(f)
+}
+
+func (f *keywordFilter) match(entry *PlaylistEntry, foldCase bool) bool {
+	switch f.keyword {
+	case "base":
+		return f.value == "" || strings.HasPrefix(entry.File, strings.TrimSuffix(f.value, "/")+"/")
+	case "modified-since":
+		return timestampAfter(entry.LastModified, f.value)
+	case "added-since":
+		return timestampAfter(entry.Added, f.value)
+	default:
+		return false
+	}
+}
+
+// timestampAfter reports whether the ISO 8601 timestamp ts is later than since.
+func timestampAfter(ts, since string) bool {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return false
+	}
+	s, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return false
+	}
+	return t.After(s)
+}
+
+type notFilter struct {
+	filter Filter
+}
+
+func (f *notFilter) appendTo(b *strings.Builder) {
+	b.WriteString("(!")
+	f.filter.appendTo(b)
+	b.WriteByte(')')
+}
+
+func (f *notFilter) String() string {
+	return filterString(f)
+}
+
+func (f *notFilter) match(entry *PlaylistEntry, foldCase bool) bool {
+	return !f.filter.match(entry, foldCase)
+}
+
+type andFilter struct {
+	filters []Filter
+}
+
+func (f *andFilter) appendTo(b *strings.Builder) {
+	if len(f.filters) == 0 {
+		// see isEmptyFilter
+		return
+	}
+	b.WriteByte('(')
+	for idx, filter := range f.filters {
+		if idx > 0 {
+			b.WriteString(" AND ")
+		}
+		filter.appendTo(b)
+	}
+	b.WriteByte(')')
+}
+
+func (f *andFilter) String() string {
+	return filterString(f)
+}
+
+func (f *andFilter) match(entry *PlaylistEntry, foldCase bool) bool {
+	for _, filter := range f.filters {
+		if !filter.match(entry, foldCase) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmptyFilter reports whether filter is or contains an And() without
+// filters, which has no MPD syntax.
+func isEmptyFilter(filter Filter) bool {
+	switch f := filter.(type) {
+	case nil:
+		return true
+	case *andFilter:
+		if len(f.filters) == 0 {
+			return true
+		}
+		for _, filter := range f.filters {
+			if isEmptyFilter(filter) {
+				return true
+			}
+		}
+	case *notFilter:
+		return isEmptyFilter(f.filter)
+	}
+	return false
+}
+
+func filterString(f Filter) string {
+	var b strings.Builder
+	f.appendTo(&b)
+	return b.String()
+}
+
+// appendQuoted writes s as a quoted string, escaping the characters MPD's
+// tokenizer treats specially.
+func appendQuoted(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\', '\'':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+}
+
+// TagEquals matches songs where tag has exactly the given value.
+func TagEquals(tag Tag, value string) Filter {
+	return &tagFilter{tag: tag, op: "==", value: value}
+}
+
+// TagNotEquals matches songs where tag does not have the given value.
+func TagNotEquals(tag Tag, value string) Filter {
+	return &tagFilter{tag: tag, op: "!=", value: value}
+}
+
+// TagContains matches songs where tag contains value as a substring.
+func TagContains(tag Tag, value string) Filter {
+	return &tagFilter{tag: tag, op: "contains", value: value}
+}
+
+// TagStartsWith matches songs where tag starts with value.
+func TagStartsWith(tag Tag, value string) Filter {
+	return &tagFilter{tag: tag, op: "starts_with", value: value}
+}
+
+// TagMatches matches songs where tag matches the Perl-compatible regular expression.
+func TagMatches(tag Tag, regex string) Filter {
+	return &tagFilter{tag: tag, op: "=~", value: regex}
+}
+
+// TagNotMatches matches songs where tag does not match the Perl-compatible regular expression.
+func TagNotMatches(tag Tag, regex string) Filter {
+	return &tagFilter{tag: tag, op: "!~", value: regex}
+}
+
+// FileEquals matches the song with the given URI.
+func FileEquals(uri string) Filter {
+	return &tagFilter{tag: TagFile, op: "==", value: uri}
+}
+
+// Base matches songs in the given directory (relative to the music directory).
+func Base(dir string) Filter {
+	return &keywordFilter{keyword: "base", value: dir}
+}
+
+// ModifiedSince matches songs whose file was modified after t.
+func ModifiedSince(t time.Time) Filter {
+	return &keywordFilter{keyword: "modified-since", value: t.UTC().Format(time.RFC3339)}
+}
+
+// AddedSince matches songs which were added to the database after t.
+func AddedSince(t time.Time) Filter {
+	return &keywordFilter{keyword: "added-since", value: t.UTC().Format(time.RFC3339)}
+}
+
+// AudioFormatEquals matches songs with the given audio format, e.g. "44100:16:2".
+func AudioFormatEquals(format string) Filter {
+	return &tagFilter{tag: "AudioFormat", op: "==", value: format}
+}
+
+// AudioFormatMatches matches songs whose audio format matches mask, e.g. "*:24:*".
+func AudioFormatMatches(mask string) Filter {
+	return &tagFilter{tag: "AudioFormat", op: "=~", value: mask}
+}
+
+// Not negates filter.
+func Not(filter Filter) Filter {
+	return &notFilter{filter: filter}
+}
+
+// And matches songs that are matched by all filters.
+//
+// And with a single filter returns that filter. Nested And() calls without
+// filters are left out. And() itself matches all songs of a LibraryIndex,
+// but renders as an empty string, and the find and search commands fail with
+// ErrEmptyFilter for it.
+func And(filters ...Filter) Filter {
+	var nonEmpty []Filter
+	for _, filter := range filters {
+		if f, ok := filter.(*andFilter); filter == nil || (ok && len(f.filters) == 0) {
+			continue
+		}
+		nonEmpty = append(nonEmpty, filter)
+	}
+	if len(nonEmpty) == 1 {
+		return nonEmpty[0]
+	}
+	return &andFilter{filters: nonEmpty}
+}
+
+type searchOptions struct {
+	sort     Tag
+	desc     bool
+	start    int
+	end      int
+	position string
+}
+
+type SearchOption func(*searchOptions)
+
+// WithSort sorts the result by tag, in descending order if desc is set.
+func WithSort(tag Tag, desc bool) SearchOption {
+	return func(o *searchOptions) {
+		o.sort = tag
+		o.desc = desc
+	}
+}
+
+// WithWindow restricts the result to the range [start, end).
+//
+// A negative end makes the window open-ended.
+func WithWindow(start, end int) SearchOption {
+	return func(o *searchOptions) {
+		o.start = start
+		o.end = end
+	}
+}
+
+// WithPosition sets the queue position songs are inserted at by FindAdd and
+// SearchAdd, or the playlist position for SearchAddPl.
+//
+// Relative positions like "+0" (directly after the current song) are passed
+// through; anything else but a number makes the command fail with
+// ErrInvalidPosition.
+func WithPosition(position string) SearchOption {
+	return func(o *searchOptions) {
+		o.position = position
+	}
+}
+
+func (o *searchOptions) args() string {
+	var b strings.Builder
+	if o.sort != "" {
+		b.WriteString(" sort ")
+		if o.desc {
+			b.WriteByte('-')
+		}
+		b.WriteString(string(o.sort))
+	}
+	if o.start > 0 || o.end >= 0 {
+		if o.end >= 0 {
+			fmt.Fprintf(&b, " window %d:%d", o.start, o.end)
+		} else {
+			fmt.Fprintf(&b, " window %d:", o.start)
+		}
+	}
+	return b.String()
+}
+
+// addArgs returns args() followed by a verb for the insert position, if set,
+// and the arguments for the verbs.
+func (o *searchOptions) addArgs(command string) (string, []interface{}, error) {
+	if o.position == "" {
+		return o.args(), nil, nil
+	}
+	if !positionRegexp.MatchString(o.position) {
+		return "", nil, fmt.Errorf("%s position %q: %w", command, o.position, ErrInvalidPosition)
+	}
+	return o.args() + " position %s", []interface{}{o.position}, nil
+}
+
+func newSearchOptions(options []SearchOption) *searchOptions {
+	o := &searchOptions{end: -1}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// legacyArgs converts filter to the "TAG VALUE ..." arguments understood by
+// servers older than MPD 0.21. Only conjunctions of the match the command
+// implies (== for find, contains for search), base and modified-since can
+// be converted.
+func legacyArgs(filter Filter, op string) ([]string, bool) {
+	switch f := filter.(type) {
+	case *tagFilter:
+		if f.op != op || f.tag == "AudioFormat" {
+			return nil, false
+		}
+		return []string{string(f.tag), f.value}, true
+	case *keywordFilter:
+		if f.keyword == "added-since" {
+			return nil, false
+		}
+		return []string{f.keyword, f.value}, true
+	case *andFilter:
+		var args []string
+		for _, filter := range f.filters {
+			filterArgs, ok := legacyArgs(filter, op)
+			if !ok {
+				return nil, false
+			}
+			args = append(args, filterArgs...)
+		}
+		return args, true
+	default:
+		return nil, false
+	}
+}
+
+// filterArgs renders filter for command, falling back to the legacy syntax
+// if the server does not support filter expressions.
+func filterArgs(client *ReconnectingClient, command string, filter Filter, o *searchOptions) (mpd.Quoted, error) {
+	if isEmptyFilter(filter) {
+		return "", fmt.Errorf("%s: %w", command, ErrEmptyFilter)
+	}
+	if client.ServerInfoCache.Load().SupportsFilters() {
+		return mpd.Quoted(quote(filter.String())), nil
+	}
+
+	op := "=="
+	if strings.HasPrefix(command, "search") {
+		op = "contains"
+	}
+	args, ok := legacyArgs(filter, op)
+	if !ok || o.sort != "" {
+		return "", fmt.Errorf("%s with filter %s: %w", command, filter, ErrUnsupportedByServer)
+	}
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		quoted[idx] = quote(arg)
+	}
+	return mpd.Quoted(strings.Join(quoted, " ")), nil
+}
+
+func searchEntries(client *ReconnectingClient, command string, filter Filter, options []SearchOption) ([]*PlaylistEntry, error) {
+	o := newSearchOptions(options)
+	args, err := filterArgs(client, command, filter, o)
+	if err != nil {
+		return nil, err
+	}
+	attrsList, err := client.Command(command+" %s"+o.args(), args).AttrsList("file")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*PlaylistEntry, len(attrsList))
+	for idx, attrs := range attrsList {
+		entries[idx] = ParsePlaylistEntryAttrs(attrs)
+	}
+	setRequestedTags(entries, client.requestedTags())
+	return entries, nil
+}
+
+func searchAdd(client *ReconnectingClient, command string, filter Filter, options []SearchOption) error {
+	o := newSearchOptions(options)
+	args, err := filterArgs(client, command, filter, o)
+	if err != nil {
+		return err
+	}
+	format, positionArgs, err := o.addArgs(command)
+	if err != nil {
+		return err
+	}
+	return client.Command(command+" %s"+format, append([]interface{}{args}, positionArgs...)...).OK()
+}
+
+// Find returns the songs in the database matching filter, case-sensitively.
+//
+// Like all commands, it must be called via Do().
+func Find(client *ReconnectingClient, filter Filter, options ...SearchOption) ([]*PlaylistEntry, error) {
+	return searchEntries(client, "find", filter, options)
+}
+
+// Search returns the songs in the database matching filter, ignoring case.
+//
+// Like all commands, it must be called via Do().
+func Search(client *ReconnectingClient, filter Filter, options ...SearchOption) ([]*PlaylistEntry, error) {
+	return searchEntries(client, "search", filter, options)
+}
+
+// FindAdd adds the songs matching filter case-sensitively to the queue.
+//
+// Like all commands, it must be called via Do().
+func FindAdd(client *ReconnectingClient, filter Filter, options ...SearchOption) error {
+	return searchAdd(client, "findadd", filter, options)
+}
+
+// SearchAdd adds the songs matching filter, ignoring case, to the queue.
+//
+// Like all commands, it must be called via Do().
+func SearchAdd(client *ReconnectingClient, filter Filter, options ...SearchOption) error {
+	return searchAdd(client, "searchadd", filter, options)
+}
+
+// SearchAddPl adds the songs matching filter, ignoring case, to the stored playlist name.
+//
+// Like all commands, it must be called via Do().
+func SearchAddPl(client *ReconnectingClient, name string, filter Filter, options ...SearchOption) error {
+	o := newSearchOptions(options)
+	args, err := filterArgs(client, "searchaddpl", filter, o)
+	if err != nil {
+		return err
+	}
+	format, positionArgs, err := o.addArgs("searchaddpl")
+	if err != nil {
+		return err
+	}
+	return client.Command("searchaddpl %s %s"+format, append([]interface{}{name, args}, positionArgs...)...).OK()
+}
@@ -0,0 +1,78 @@
+package mmpd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFilterString(t *testing.T) {
+	tests := []struct {
+		filter Filter
+		want   string
+	}{
+		{TagEquals(TagArtist, "A"), `(Artist == "A")`},
+		{TagContains(TagTitle, `say "hi"`), `(Title contains "say \"hi\"")`},
+		{TagStartsWith(TagAlbum, `it's \o/`), `(Album starts_with "it\'s \\o/")`},
+		{Not(TagMatches(TagGenre, "^Rock$")), `(!(Genre =~ "^Rock$"))`},
+		{And(TagEquals(TagArtist, "A"), Base("music/a")), `((Artist == "A") AND (base "music/a"))`},
+		{And(TagEquals(TagArtist, "A")), `(Artist == "A")`},
+		{And(TagEquals(TagArtist, "A"), And()), `(Artist == "A")`},
+		{ModifiedSince(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), `(modified-since "2024-01-02T03:04:05Z")`},
+		{AudioFormatMatches("*:24:*"), `(AudioFormat =~ "*:24:*")`},
+		{And(), ``},
+	}
+	for _, test := range tests {
+		if got := test.filter.String(); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestEmptyFilter(t *testing.T) {
+	for _, filter := range []Filter{nil, And(), Not(And()), &andFilter{filters: []Filter{TagEquals(TagArtist, "A"), And()}}} {
+		if _, err := filterArgs(nil, "find", filter, newSearchOptions(nil)); !errors.Is(err, ErrEmptyFilter) {
+			t.Errorf("%v: got %v, want ErrEmptyFilter", filter, err)
+		}
+	}
+
+	song := &PlaylistEntry{File: "a.flac", Artist: "A"}
+	if !And().match(song, false) {
+		t.Error("And() does not match all songs")
+	}
+}
+
+func TestAddArgsPosition(t *testing.T) {
+	tests := []struct {
+		position string
+		valid    bool
+	}{
+		{"", true},
+		{"0", true},
+		{"12", true},
+		{"+0", true},
+		{"-1", true},
+		{"+", false},
+		{"1.5", false},
+		{"first", false},
+		{`0" "x`, false},
+		{"0\nclear", false},
+	}
+	for _, test := range tests {
+		format, args, err := newSearchOptions([]SearchOption{WithPosition(test.position)}).addArgs("findadd")
+		switch {
+		case !test.valid:
+			if !errors.Is(err, ErrInvalidPosition) {
+				t.Errorf("%q: got %v, want ErrInvalidPosition", test.position, err)
+			}
+		case err != nil:
+			t.Errorf("%q: %v", test.position, err)
+		case test.position == "":
+			if format != "" || len(args) != 0 {
+				t.Errorf("no position: got %q %v", format, args)
+			}
+		case format != " position %s" || len(args) != 1 || args[0] != test.position:
+			t.Errorf("%q: got %q %v", test.position, format, args)
+		}
+	}
+}
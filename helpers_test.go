@@ -0,0 +1,112 @@
+package mmpd_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+// testSongs is the database of the test servers.
+var testSongs = []mpdtest.Song{
+	mpdtest.NewSong("a/1.flac", "Artist", "A", "Album", "First", "Title", "One", "Track", "1/3", "duration", "181.5", "Format", "44100:16:2"),
+	mpdtest.NewSong("a/2.flac", "Artist", "A", "Album", "First", "Title", "Two", "Track", "2/3", "duration", "200.25", "Format", "44100:16:2"),
+	mpdtest.NewSong("a/3.flac", "Artist", "A", "Album", "First", "Title", "Three", "Track", "3/3", "duration", "95", "Format", "44100:16:2"),
+	mpdtest.NewSong("b/1.flac", "Artist", "B", "Album", "Second", "Title", "Uno", "Track", "A1", "Disc", "1/2", "duration", "240", "Format", "96000:24:2"),
+}
+
+// startServer starts a server with testSongs, which is closed at the end of the test.
+func startServer(t *testing.T, options ...mpdtest.Option) *mpdtest.Server {
+	t.Helper()
+
+	return startServerWith(t, append([]mpdtest.Option{mpdtest.WithDatabase(testSongs...)}, options...)...)
+}
+
+// startServerWith starts a server with only the given options.
+func startServerWith(t *testing.T, options ...mpdtest.Option) *mpdtest.Server {
+	t.Helper()
+
+	srv, err := mpdtest.NewServer(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv
+}
+
+// server is a server clients can connect to, a Server or ReplayServer.
+type server interface {
+	Network() string
+	Addr() string
+}
+
+// connect connects a client to srv without keepalive, so the caches are only
+// refreshed when the test asks for it. The client is closed at the end of
+// the test.
+func connect(t *testing.T, srv server, options ...mmpd.ClientOption) *mmpd.ReconnectingClient {
+	t.Helper()
+
+	options = append([]mmpd.ClientOption{mmpd.WithBlocking(), mmpd.WithKeepalive(false)}, options...)
+	client, err := mmpd.NewReconnectingClient(srv.Network(), srv.Addr(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// exec runs command lines on srv.
+func exec(t *testing.T, srv *mpdtest.Server, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		if _, err := srv.Exec(line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+}
+
+// serverQueue returns the files in the queue of srv.
+func serverQueue(t *testing.T, srv *mpdtest.Server) []string {
+	t.Helper()
+
+	lines, err := srv.Exec("playlistinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, line := range lines {
+		if file, ok := strings.CutPrefix(line, "file: "); ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// eventually fails the test if cond does not become true within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// receive returns the next value of ch, failing the test if there is none
+// within a few seconds.
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		panic("unreachable")
+	}
+}
@@ -0,0 +1,234 @@
+// Command equals-gen generates field-by-field Equals methods for structs of
+// the mmpd package, and optionally a changed-fields Diff method.
+//
+// Fields tagged `equals:"-"` are ignored.
+//
+//	equals-gen -o equals.go -diff Status Status PlaylistEntry
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func main() {
+	output := flag.String("o", "equals.go", "output file")
+	diff := flag.String("diff", "", "comma-separated types to generate Diff methods and field constants for")
+	flag.Parse()
+
+	types := flag.Args()
+	if len(types) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: equals-gen [-o file] [-diff types] type...")
+		os.Exit(2)
+	}
+
+	diffTypes := map[string]bool{}
+	for _, t := range strings.Split(*diff, ",") {
+		if t != "" {
+			diffTypes[t] = true
+		}
+	}
+
+	structs, pkgName, err := parseStructs(".", *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	g := &generator{imports: map[string]bool{}}
+	for _, name := range types {
+		st, ok := structs[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "struct %s not found\n", name)
+			os.Exit(1)
+		}
+		if err := g.generate(name, st, diffTypes[name]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by equals-gen; DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+	if len(g.imports) > 0 {
+		var imports []string
+		for imp := range g.imports {
+			imports = append(imports, imp)
+		}
+		sort.Strings(imports)
+		out.WriteString("import (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&out, "\t%q\n", imp)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "formatting output: %v\n%s", err, out.String())
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parseStructs(dir string, skip string) (map[string]*ast.StructType, string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return fi.Name() != skip && !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	structs := map[string]*ast.StructType{}
+	var pkgName string
+	for name, pkg := range pkgs {
+		pkgName = name
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				if ts, ok := n.(*ast.TypeSpec); ok {
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						structs[ts.Name.Name] = st
+					}
+				}
+				return true
+			})
+		}
+	}
+	return structs, pkgName, nil
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(name string, st *ast.StructType, diff bool) error {
+	var fields []string
+	var differs []string
+	for _, field := range st.Fields.List {
+		if field.Tag != nil {
+			if tag, err := strconv.Unquote(field.Tag.Value); err == nil && reflect.StructTag(tag).Get("equals") == "-" {
+				continue
+			}
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			expr, err := g.differs(field.Type, "a."+ident.Name, "b."+ident.Name)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, ident.Name, err)
+			}
+			fields = append(fields, ident.Name)
+			differs = append(differs, expr)
+		}
+	}
+
+	recv := receiverName(name)
+	g.printf("// Equals reports whether all fields of %s and other are equal.\n", recv)
+	g.printf("func (%s *%s) Equals(other *%s) bool {\n", recv, name, name)
+	g.printf("if %s == nil || other == nil {\nreturn %s == other\n}\n", recv, recv)
+	g.printf("a, b := %s, other\n", recv)
+	g.printf("return !(%s)\n}\n\n", strings.Join(differs, " ||\n"))
+
+	if !diff {
+		return nil
+	}
+	if len(fields) > 64 {
+		return fmt.Errorf("%s has more than 64 fields", name)
+	}
+
+	fieldType := name + "Field"
+	g.printf("// %s is a set of %s fields.\n", fieldType, name)
+	g.printf("type %s uint64\n\n", fieldType)
+	g.printf("const (\n")
+	for idx, field := range fields {
+		if idx == 0 {
+			g.printf("%s%s %s = 1 << iota\n", name, field, fieldType)
+		} else {
+			g.printf("%s%s\n", name, field)
+		}
+	}
+	g.printf(")\n\n")
+	g.printf("// All%sFields contains all fields of %s.\n", name, name)
+	g.printf("const All%sFields = %s%s<<1 - 1\n\n", name, name, fields[len(fields)-1])
+
+	g.printf("var %sFieldNames = [...]string{\n", strings.ToLower(name[:1])+name[1:])
+	for _, field := range fields {
+		g.printf("%q,\n", field)
+	}
+	g.printf("}\n\n")
+
+	g.imports["strings"] = true
+	g.printf("func (f %s) String() string {\n", fieldType)
+	g.printf("var names []string\n")
+	g.printf("for idx, name := range %sFieldNames {\nif f&(1<<idx) != 0 {\nnames = append(names, name)\n}\n}\n", strings.ToLower(name[:1])+name[1:])
+	g.printf("return strings.Join(names, \",\")\n}\n\n")
+
+	g.printf("// Diff returns the fields that differ between %s and other. All fields\n", recv)
+	g.printf("// are returned if either is nil.\n")
+	g.printf("func (%s *%s) Diff(other *%s) %s {\n", recv, name, name, fieldType)
+	g.printf("if %s == nil || other == nil {\nif %s == other {\nreturn 0\n}\nreturn All%sFields\n}\n", recv, recv, name)
+	g.printf("a, b := %s, other\n", recv)
+	g.printf("var changed %s\n", fieldType)
+	for idx, field := range fields {
+		g.printf("if %s {\nchanged |= %s%s\n}\n", differs[idx], name, field)
+	}
+	g.printf("return changed\n}\n\n")
+	return nil
+}
+
+// receiverName returns the lowercased initials of name, e.g. "pe" for PlaylistEntry.
+func receiverName(name string) string {
+	var recv strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			recv.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return recv.String()
+}
+
+// differs returns an expression that is true if a and b of type expr differ.
+func (g *generator) differs(expr ast.Expr, a, b string) (string, error) {
+	switch t := expr.(type) {
+	case *ast.Ident, *ast.StarExpr:
+		return fmt.Sprintf("%s != %s", a, b), nil
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" && t.Sel.Name == "Time" {
+			return fmt.Sprintf("!%s.Equal(%s)", a, b), nil
+		}
+		return fmt.Sprintf("%s != %s", a, b), nil
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return fmt.Sprintf("%s != %s", a, b), nil
+		}
+		g.imports["slices"] = true
+		return fmt.Sprintf("!slices.Equal(%s, %s)", a, b), nil
+	case *ast.MapType:
+		g.imports["maps"] = true
+		return fmt.Sprintf("!maps.Equal(%s, %s)", a, b), nil
+	default:
+		return "", fmt.Errorf("unsupported field type %T", expr)
+	}
+}
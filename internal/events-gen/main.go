@@ -0,0 +1,92 @@
+// Command events-gen generates a listener type for each event function type
+// declared in the handwritten part of an events file, which ends with the
+// marker line. Everything after the marker is replaced.
+//
+//	events-gen events.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"strings"
+)
+
+const marker = "// Code below generated by events-gen; DO NOT EDIT.\n"
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: events-gen file")
+		os.Exit(2)
+	}
+	path := os.Args[1]
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	head, _, ok := bytes.Cut(src, []byte(marker))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s: marker not found\n", path)
+		os.Exit(1)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, head, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var out bytes.Buffer
+	out.Write(head)
+	out.WriteString(marker)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ft, ok := ts.Type.(*ast.FuncType); ok {
+				generate(&out, fset, ts.Name.Name, ft)
+			}
+		}
+	}
+
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "formatting output: %v\n%s", err, out.String())
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, formatted, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// generate writes the listener type of the event function type name, its
+// method calling the function and its constructor.
+func generate(out *bytes.Buffer, fset *token.FileSet, name string, ft *ast.FuncType) {
+	var params, args []string
+	for _, field := range ft.Params.List {
+		var typ bytes.Buffer
+		_ = printer.Fprint(&typ, fset, field.Type)
+		for _, ident := range field.Names {
+			params = append(params, ident.Name+" "+typ.String())
+			args = append(args, ident.Name)
+		}
+	}
+	signature := "func(" + strings.Join(params, ", ") + ")"
+	listener := name + "Listener"
+
+	fmt.Fprintf(out, "\ntype %s struct {\nfn %s\n}\n\n", listener, signature)
+	fmt.Fprintf(out, "func (l *%s) %s(%s) {\nl.fn(%s)\n}\n\n", listener, name, strings.Join(params, ", "), strings.Join(args, ", "))
+	fmt.Fprintf(out, "func New%s(fn %s) *%s {\nreturn &%s{fn: fn}\n}\n", listener, signature, listener, listener)
+}
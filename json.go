@@ -0,0 +1,380 @@
+package mmpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// JSON representation
+//
+// Status, Playlist, PlaylistEntry and CurrentSong encode to JSON objects with
+// snake_case names. The representation is stable: names are only added, never
+// renamed or removed.
+//
+//   - empty tags and unset optional values are omitted; pos and id are
+//     always present, and 0 for songs that are not in the queue
+//   - NaN and infinite numbers, which JSON cannot represent, are encoded as 0
+//   - Single and Consume are "off", "on" or "oneshot"
+//   - durations (elapsed, duration, crossfade, mixramp_delay, range) are
+//     fractional seconds
+//   - audio formats are strings in MPD notation, e.g. "44100:16:2"
+//   - track, disc and movement_number are the raw tag values; the parsed
+//     numbers are added as track_number, track_total etc. for convenience,
+//     and ignored when decoding
+//
+// Decoding restores the parsed fields (AudioFormat, SongRange, Numbering) from
+// the raw values, so a decoded value Equals the encoded one. The deprecated
+// Status.Time and Status.TotalTime are not encoded, and derived from elapsed
+// and duration when decoding.
+
+func (s OffOnOneshot) MarshalText() ([]byte, error) {
+	switch s {
+	case On:
+		return []byte("on"), nil
+	case Oneshot:
+		return []byte("oneshot"), nil
+	default:
+		return []byte("off"), nil
+	}
+}
+
+// UnmarshalText accepts "off", "on" and "oneshot", as well as the protocol values.
+func (s *OffOnOneshot) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "off", "0":
+		*s = Off
+	case "on", "1":
+		*s = On
+	case "oneshot":
+		*s = Oneshot
+	default:
+		return fmt.Errorf("invalid value '%s', expected off, on or oneshot", text)
+	}
+	return nil
+}
+
+func (af AudioFormat) MarshalText() ([]byte, error) {
+	return []byte(af.String()), nil
+}
+
+func (af *AudioFormat) UnmarshalText(text []byte) error {
+	parsed, err := ParseAudioFormat(string(text))
+	if err != nil {
+		return err
+	}
+	*af = parsed
+	return nil
+}
+
+type songRangeJSON struct {
+	Start float64  `json:"start"`
+	End   *float64 `json:"end,omitempty"`
+}
+
+func (r SongRange) MarshalJSON() ([]byte, error) {
+	j := songRangeJSON{Start: r.Start.Seconds()}
+	if !r.IsOpen() {
+		end := r.End.Seconds()
+		j.End = &end
+	}
+	return json.Marshal(j)
+}
+
+func (r *SongRange) UnmarshalJSON(data []byte) error {
+	var j songRangeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*r = SongRange{Start: secondsToDuration(j.Start)}
+	if j.End != nil {
+		r.End = secondsToDuration(*j.End)
+	}
+	return nil
+}
+
+type statusJSON struct {
+	Partition          string            `json:"partition,omitempty"`
+	Volume             int               `json:"volume"`
+	Repeat             bool              `json:"repeat"`
+	Random             bool              `json:"random"`
+	Single             OffOnOneshot      `json:"single"`
+	Consume            OffOnOneshot      `json:"consume"`
+	Playlist           uint32            `json:"playlist"`
+	PlaylistLength     int               `json:"playlist_length"`
+	State              PlayerState       `json:"state"`
+	Song               int               `json:"song"`
+	SongId             int               `json:"song_id"`
+	NextSong           int               `json:"next_song"`
+	NextSongId         int               `json:"next_song_id"`
+	Elapsed            float64           `json:"elapsed"`
+	Duration           float64           `json:"duration"`
+	Bitrate            int               `json:"bitrate"`
+	CrossFade          int               `json:"crossfade"`
+	MixRampDB          float64           `json:"mixramp_db"`
+	MixRampDelay       float64           `json:"mixramp_delay"`
+	Audio              string            `json:"audio,omitempty"`
+	UpdatingDB         string            `json:"updating_db,omitempty"`
+	Error              string            `json:"error,omitempty"`
+	LastLoadedPlaylist string            `json:"last_loaded_playlist,omitempty"`
+	Extra              map[string]string `json:"extra,omitempty"`
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(statusJSON{
+		Partition:          s.Partition,
+		Volume:             s.Volume,
+		Repeat:             s.Repeat,
+		Random:             s.Random,
+		Single:             s.Single,
+		Consume:            s.Consume,
+		Playlist:           s.Playlist,
+		PlaylistLength:     s.PlaylistLength,
+		State:              s.State,
+		Song:               s.Song,
+		SongId:             s.SongId,
+		NextSong:           s.NextSong,
+		NextSongId:         s.NextSongId,
+		Elapsed:            s.ElapsedTime().Seconds(),
+		Duration:           s.DurationTime().Seconds(),
+		Bitrate:            s.Bitrate,
+		CrossFade:          s.CrossFade,
+		MixRampDB:          finite(s.MixRampDB),
+		MixRampDelay:       finite(s.MixRampDelay),
+		Audio:              s.Audio,
+		UpdatingDB:         s.UpdatingDB,
+		Error:              s.Error,
+		LastLoadedPlaylist: s.LastLoadedPlaylist,
+		Extra:              s.Extra,
+	})
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var j statusJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	audioFormat, err := ParseAudioFormat(j.Audio)
+	if err != nil {
+		return err
+	}
+
+	elapsed, duration := secondsToDuration(j.Elapsed), secondsToDuration(j.Duration)
+	*s = Status{
+		Partition:          j.Partition,
+		Volume:             j.Volume,
+		Repeat:             j.Repeat,
+		Random:             j.Random,
+		Single:             j.Single,
+		Consume:            j.Consume,
+		Playlist:           j.Playlist,
+		PlaylistLength:     j.PlaylistLength,
+		State:              j.State,
+		Song:               j.Song,
+		SongId:             j.SongId,
+		NextSong:           j.NextSong,
+		NextSongId:         j.NextSongId,
+		Time:               int(elapsed.Round(time.Second).Seconds()),
+		TotalTime:          int(duration.Round(time.Second).Seconds()),
+		Elapsed:            elapsed.Seconds(),
+		Duration:           duration.Seconds(),
+		Bitrate:            j.Bitrate,
+		CrossFade:          j.CrossFade,
+		MixRampDB:          j.MixRampDB,
+		MixRampDelay:       j.MixRampDelay,
+		Audio:              j.Audio,
+		AudioFormat:        audioFormat,
+		UpdatingDB:         j.UpdatingDB,
+		Error:              j.Error,
+		LastLoadedPlaylist: j.LastLoadedPlaylist,
+		Extra:              j.Extra,
+	}
+	return nil
+}
+
+type playlistEntryJSON struct {
+	File                      string     `json:"file,omitempty"`
+	Artist                    string     `json:"artist,omitempty"`
+	ArtistSort                string     `json:"artist_sort,omitempty"`
+	Album                     string     `json:"album,omitempty"`
+	AlbumSort                 string     `json:"album_sort,omitempty"`
+	AlbumArtist               string     `json:"album_artist,omitempty"`
+	AlbumArtistSort           string     `json:"album_artist_sort,omitempty"`
+	Title                     string     `json:"title,omitempty"`
+	TitleSort                 string     `json:"title_sort,omitempty"`
+	Track                     string     `json:"track,omitempty"`
+	TrackNumber               int        `json:"track_number,omitempty"`
+	TrackTotal                int        `json:"track_total,omitempty"`
+	Name                      string     `json:"name,omitempty"`
+	Genre                     string     `json:"genre,omitempty"`
+	Mood                      string     `json:"mood,omitempty"`
+	Date                      string     `json:"date,omitempty"`
+	OriginalDate              string     `json:"original_date,omitempty"`
+	Composer                  string     `json:"composer,omitempty"`
+	ComposerSort              string     `json:"composer_sort,omitempty"`
+	Performer                 string     `json:"performer,omitempty"`
+	Conductor                 string     `json:"conductor,omitempty"`
+	Work                      string     `json:"work,omitempty"`
+	Ensemble                  string     `json:"ensemble,omitempty"`
+	Movement                  string     `json:"movement,omitempty"`
+	MovementNumber            string     `json:"movement_number,omitempty"`
+	Location                  string     `json:"location,omitempty"`
+	Grouping                  string     `json:"grouping,omitempty"`
+	Comment                   string     `json:"comment,omitempty"`
+	Disc                      string     `json:"disc,omitempty"`
+	DiscNumber                int        `json:"disc_number,omitempty"`
+	DiscTotal                 int        `json:"disc_total,omitempty"`
+	Label                     string     `json:"label,omitempty"`
+	MusicbrainzArtistId       string     `json:"musicbrainz_artistid,omitempty"`
+	MusicbrainzAlbumId        string     `json:"musicbrainz_albumid,omitempty"`
+	MusicbrainzAlbumArtistId  string     `json:"musicbrainz_albumartistid,omitempty"`
+	MusicbrainzTrackId        string     `json:"musicbrainz_trackid,omitempty"`
+	MusicbrainzReleaseGroupId string     `json:"musicbrainz_releasegroupid,omitempty"`
+	MusicbrainzReleaseTrackId string     `json:"musicbrainz_releasetrackid,omitempty"`
+	MusicbrainzWorkId         string     `json:"musicbrainz_workid,omitempty"`
+	Duration                  float64    `json:"duration,omitempty"`
+	Range                     *SongRange `json:"range,omitempty"`
+	Format                    string     `json:"format,omitempty"`
+	LastModified              string     `json:"last_modified,omitempty"`
+	Added                     string     `json:"added,omitempty"`
+	Pos                       int        `json:"pos"`
+	Id                        int        `json:"id"`
+	Prio                      int        `json:"prio,omitempty"`
+	RequestedTags             []Tag      `json:"requested_tags,omitempty"`
+}
+
+func (pe PlaylistEntry) MarshalJSON() ([]byte, error) {
+	j := playlistEntryJSON{
+		File:                      pe.File,
+		Artist:                    pe.Artist,
+		ArtistSort:                pe.ArtistSort,
+		Album:                     pe.Album,
+		AlbumSort:                 pe.AlbumSort,
+		AlbumArtist:               pe.AlbumArtist,
+		AlbumArtistSort:           pe.AlbumArtistSort,
+		Title:                     pe.Title,
+		TitleSort:                 pe.TitleSort,
+		Track:                     pe.TagValue(TagTrack),
+		TrackNumber:               pe.Track,
+		TrackTotal:                pe.TrackNumbering.Total,
+		Name:                      pe.Name,
+		Genre:                     pe.Genre,
+		Mood:                      pe.Mood,
+		Date:                      pe.Date,
+		OriginalDate:              pe.OriginalDate,
+		Composer:                  pe.Composer,
+		ComposerSort:              pe.ComposerSort,
+		Performer:                 pe.Performer,
+		Conductor:                 pe.Conductor,
+		Work:                      pe.Work,
+		Ensemble:                  pe.Ensemble,
+		Movement:                  pe.Movement,
+		MovementNumber:            pe.MovementNumber,
+		Location:                  pe.Location,
+		Grouping:                  pe.Grouping,
+		Comment:                   pe.Comment,
+		Disc:                      pe.TagValue(TagDisc),
+		DiscNumber:                pe.Disc,
+		DiscTotal:                 pe.DiscNumbering.Total,
+		Label:                     pe.Label,
+		MusicbrainzArtistId:       pe.MusicbrainzArtistId,
+		MusicbrainzAlbumId:        pe.MusicbrainzAlbumId,
+		MusicbrainzAlbumArtistId:  pe.MusicbrainzAlbumArtistId,
+		MusicbrainzTrackId:        pe.MusicbrainzTrackId,
+		MusicbrainzReleaseGroupId: pe.MusicbrainzReleaseGroupId,
+		MusicbrainzReleaseTrackId: pe.MusicbrainzReleaseTrackId,
+		MusicbrainzWorkId:         pe.MusicbrainzWorkId,
+		Duration:                  pe.Length().Seconds(),
+		Format:                    pe.Format,
+		LastModified:              pe.LastModified,
+		Added:                     pe.Added,
+		Pos:                       pe.Pos,
+		Id:                        pe.Id,
+		Prio:                      pe.Prio,
+		RequestedTags:             pe.RequestedTags,
+	}
+	if !pe.SongRange.IsZero() {
+		j.Range = &pe.SongRange
+	}
+	return json.Marshal(j)
+}
+
+func (pe *PlaylistEntry) UnmarshalJSON(data []byte) error {
+	var j playlistEntryJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	duration := secondsToDuration(j.Duration)
+	*pe = PlaylistEntry{
+		File:                      j.File,
+		Artist:                    j.Artist,
+		ArtistSort:                j.ArtistSort,
+		Album:                     j.Album,
+		AlbumSort:                 j.AlbumSort,
+		AlbumArtist:               j.AlbumArtist,
+		AlbumArtistSort:           j.AlbumArtistSort,
+		Title:                     j.Title,
+		TitleSort:                 j.TitleSort,
+		Name:                      j.Name,
+		Genre:                     j.Genre,
+		Mood:                      j.Mood,
+		Date:                      j.Date,
+		OriginalDate:              j.OriginalDate,
+		Composer:                  j.Composer,
+		ComposerSort:              j.ComposerSort,
+		Performer:                 j.Performer,
+		Conductor:                 j.Conductor,
+		Work:                      j.Work,
+		Ensemble:                  j.Ensemble,
+		Movement:                  j.Movement,
+		Location:                  j.Location,
+		Grouping:                  j.Grouping,
+		Comment:                   j.Comment,
+		Label:                     j.Label,
+		MusicbrainzArtistId:       j.MusicbrainzArtistId,
+		MusicbrainzAlbumId:        j.MusicbrainzAlbumId,
+		MusicbrainzAlbumArtistId:  j.MusicbrainzAlbumArtistId,
+		MusicbrainzTrackId:        j.MusicbrainzTrackId,
+		MusicbrainzReleaseGroupId: j.MusicbrainzReleaseGroupId,
+		MusicbrainzReleaseTrackId: j.MusicbrainzReleaseTrackId,
+		MusicbrainzWorkId:         j.MusicbrainzWorkId,
+		Duration:                  duration.Seconds(),
+		Time:                      int(duration.Round(time.Second).Seconds()),
+		Format:                    j.Format,
+		LastModified:              j.LastModified,
+		Added:                     j.Added,
+		Pos:                       j.Pos,
+		Id:                        j.Id,
+		Prio:                      j.Prio,
+		RequestedTags:             j.RequestedTags,
+	}
+	if j.Track != "" {
+		pe.TrackNumbering = ParseNumbering(j.Track)
+		pe.Track = pe.TrackNumbering.Number
+	}
+	if j.Disc != "" {
+		pe.DiscNumbering = ParseNumbering(j.Disc)
+		pe.Disc = pe.DiscNumbering.Number
+	}
+	if j.MovementNumber != "" {
+		pe.MovementNumber = j.MovementNumber
+		pe.MovementNumbering = ParseMovementNumbering(j.MovementNumber)
+	}
+	if j.Range != nil {
+		pe.SongRange = *j.Range
+		pe.Range = j.Range.protocolString()
+	}
+	pe.AudioFormat, _ = ParseAudioFormat(j.Format)
+	return nil
+}
+
+// finite returns f, or 0 if it is NaN or infinite.
+func finite(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,128 @@
+package mmpd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fhs/gompd/v2/mpd"
+	"github.com/mkke/mmpd"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// golden compares data with the golden file name, or replaces the file with
+// -update.
+func golden(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	file := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s changed:\n%s", file, data)
+	}
+}
+
+func marshalIndent(t *testing.T, v any) []byte {
+	t.Helper()
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+func jsonTestStatus() *mmpd.Status {
+	return mmpd.ParseStatusAttrs(mpd.Attrs{
+		"partition": "default", "volume": "50", "repeat": "0", "random": "1", "single": "oneshot", "consume": "0",
+		"playlist": "42", "playlistlength": "3", "state": "play", "song": "1", "songid": "2", "nextsong": "2", "nextsongid": "3",
+		"time": "10:216", "elapsed": "10.123", "duration": "215.573", "bitrate": "1411", "xfade": "2",
+		"mixrampdb": "-17.500000", "mixrampdelay": "nan", "audio": "96000:24:2", "lastloadedplaylist": "evening",
+		"newattribute": "value",
+	})
+}
+
+func jsonTestPlaylist() *mmpd.Playlist {
+	return &mmpd.Playlist{
+		Version: 42,
+		Entries: []*mmpd.PlaylistEntry{
+			mmpd.ParsePlaylistEntryAttrs(mpd.Attrs{
+				"file": "a/1.flac", "Artist": "A", "Album": "First", "Title": "One", "Track": "1/3", "Disc": "1/2",
+				"duration": "181.5", "Time": "182", "Format": "44100:16:2", "Last-Modified": "2024-05-01T10:00:00Z",
+				"Pos": "0", "Id": "1",
+			}),
+			mmpd.ParsePlaylistEntryAttrs(mpd.Attrs{
+				"file": "b/vinyl.flac", "Artist": "B", "Title": "Side A", "Track": "A1", "MovementNumber": "IV",
+				"duration": "215.573", "Time": "216", "Range": "60.000-120.500", "Format": "96000:24:2", "Pos": "1", "Id": "2", "Prio": "10",
+			}),
+			mmpd.ParsePlaylistEntryAttrs(mpd.Attrs{
+				"file": "http://radio.example/stream", "Name": "Radio", "Title": "Live", "Range": "30.000-", "Pos": "2", "Id": "3",
+			}),
+		},
+	}
+}
+
+func TestJSONGolden(t *testing.T) {
+	status, playlist := jsonTestStatus(), jsonTestPlaylist()
+	currentSong := mmpd.NewCurrentSong(status, playlist)
+
+	golden(t, "status.json", marshalIndent(t, status))
+	golden(t, "playlist.json", marshalIndent(t, playlist))
+	golden(t, "current_song.json", marshalIndent(t, currentSong))
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	status := jsonTestStatus()
+	var decodedStatus mmpd.Status
+	if err := json.Unmarshal(marshalIndent(t, status), &decodedStatus); err != nil {
+		t.Fatal(err)
+	}
+	status.ParseErrors = nil
+	if changed := status.Diff(&decodedStatus); changed != 0 {
+		t.Errorf("decoded status differs in %v", changed)
+	}
+
+	playlist := jsonTestPlaylist()
+	var decodedPlaylist mmpd.Playlist
+	if err := json.Unmarshal(marshalIndent(t, playlist), &decodedPlaylist); err != nil {
+		t.Fatal(err)
+	}
+	if decodedPlaylist.Version != playlist.Version || len(decodedPlaylist.Entries) != len(playlist.Entries) {
+		t.Fatalf("decoded playlist %+v", decodedPlaylist)
+	}
+	for pos, entry := range playlist.Entries {
+		if decoded := decodedPlaylist.Entries[pos]; !decoded.Equals(entry) || decoded.Length() != entry.Length() {
+			t.Errorf("decoded entry %d is %+v, want %+v", pos, decoded, entry)
+		}
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+	// values encode like pointers, e.g. in slices of values
+	status, entry := jsonTestStatus(), jsonTestPlaylist().Entries[0]
+	if !bytes.Equal(marshalIndent(t, *status), marshalIndent(t, status)) {
+		t.Error("Status value encoded differently")
+	}
+	if !bytes.Equal(marshalIndent(t, []mmpd.PlaylistEntry{*entry}), marshalIndent(t, []*mmpd.PlaylistEntry{entry})) {
+		t.Error("PlaylistEntry value encoded differently")
+	}
+
+	status.MixRampDB, status.MixRampDelay = math.Inf(-1), math.NaN()
+	if _, err := json.Marshal(status); err != nil {
+		t.Errorf("non-finite numbers: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package mmpd_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+func TestKeepalive(t *testing.T) {
+	srv := startServer(t)
+	clock := mpdtest.NewClock(time.Now())
+	pings := make(chan struct{}, 10)
+	connect(t, srv, mmpd.WithClock(clock), mmpd.WithKeepalive(true), mmpd.WithPingFunc(func(client *mmpd.ReconnectingClient) error {
+		pings <- struct{}{}
+		return mmpd.Ping(client)
+	}))
+
+	// the ping right after connecting
+	receive(t, pings)
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(59 * time.Second)
+		select {
+		case <-pings:
+			t.Fatal("ping before the keepalive interval")
+		case <-time.After(20 * time.Millisecond):
+		}
+		clock.Advance(time.Second)
+		receive(t, pings)
+	}
+}
+
+func TestKeepaliveReconnects(t *testing.T) {
+	srv := startServer(t)
+	clock := mpdtest.NewClock(time.Now())
+	dialer := mpdtest.NewDialer()
+	client := connect(t, srv, mmpd.WithClock(clock), mmpd.WithDialer(dialer), mmpd.WithKeepalive(true))
+	connected := make(chan struct{}, 10)
+	client.ConnectedListeners.Add(mmpd.NewConnectedListener(func(*mmpd.ReconnectingClient) {
+		connected <- struct{}{}
+	}))
+
+	clock.BlockUntil(1)
+	dialer.Sever()
+	clock.Advance(time.Minute)
+	receive(t, connected)
+	if err := client.Do(mmpd.Ping); err != nil {
+		t.Errorf("ping after reconnect: %v", err)
+	}
+	if dialer.Dials() < 2 {
+		t.Errorf("%d dials", dialer.Dials())
+	}
+}
+
+func TestDialFailure(t *testing.T) {
+	srv := startServer(t)
+	dialer := mpdtest.NewDialer()
+	failure := errors.New("no route to MPD")
+	dialer.SetFailure(failure)
+
+	client, err := mmpd.NewReconnectingClient(srv.Network(), srv.Addr(), mmpd.WithBlocking(), mmpd.WithDialer(dialer))
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, want the dial error", err)
+	}
+	if client != nil {
+		_ = client.Close()
+	}
+}
+
+func TestBatchWithoutDial(t *testing.T) {
+	srv := startServer(t)
+	dialer := mpdtest.NewDialer()
+	client := connect(t, srv, mmpd.WithDialer(dialer))
+	// the server info is queried on side connections after connecting
+	eventually(t, "server info", func() bool { return client.ServerInfoCache.Load() != nil })
+	dials := dialer.Dials()
+
+	// the batch uses the connection of the client
+	dialer.SetFailure(errors.New("no route to MPD"))
+	batch := client.Batch()
+	batch.SetVolume(30)
+	if err := batch.Run(); err != nil {
+		t.Error(err)
+	}
+	if dialer.Dials() != dials {
+		t.Errorf("%d dials for the batch", dialer.Dials()-dials)
+	}
+}
+
+func TestSeverMidCommand(t *testing.T) {
+	srv := startServer(t)
+	dialer := mpdtest.NewDialer()
+	client := connect(t, srv, mmpd.WithDialer(dialer))
+
+	// the connection breaks while MPD runs the command
+	sever := func([]string) ([]string, error) {
+		srv.Handle("status", nil)
+		dialer.Sever()
+		return nil, errors.New("severed")
+	}
+	srv.Handle("status", sever)
+	err := client.Do(func(client *mmpd.ReconnectingClient) error {
+		_, err := client.Status()
+		return err
+	})
+	if !mmpd.IsTransient(err) {
+		t.Errorf("status on severed connection: %v", err)
+	}
+	eventually(t, "reconnect", client.IsConnected)
+
+	// idempotent commands are retried on the new connection
+	srv.Handle("status", sever)
+	if err := client.DoIdempotent(mmpd.RefreshCache); err != nil {
+		t.Errorf("retried refresh: %v", err)
+	}
+}
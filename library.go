@@ -0,0 +1,311 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+// Directory represents a directory in the music database.
+type Directory struct {
+	// the directory path relative to the music directory.
+	Path string
+
+	// the time stamp of the last modification of the directory in ISO 8601 format.
+	LastModified string
+}
+
+// StoredPlaylist represents a stored playlist, or a playlist file in the music directory.
+type StoredPlaylist struct {
+	// the playlist name, or its path for playlist files.
+	Name string
+
+	// the time stamp of the last modification of the playlist in ISO 8601 format.
+	LastModified string
+}
+
+// File represents a file as listed by listfiles, which does not parse tags.
+type File struct {
+	// the file name relative to the listed directory.
+	Name string
+
+	// the file size in bytes.
+	Size int64
+
+	// the time stamp of the last modification of the file in ISO 8601 format.
+	LastModified string
+}
+
+// LibraryEntry is one entry of a library listing. Exactly one of its fields is set.
+type LibraryEntry struct {
+	Directory *Directory
+	Song      *PlaylistEntry
+	Playlist  *StoredPlaylist
+	File      *File
+}
+
+// LibraryIterator streams the entries of a library listing.
+//
+//	it := library.ListAllInfo("")
+//	defer it.Close()
+//	for it.Next() {
+//		entry := it.Entry()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type LibraryIterator struct {
+	conn  *rawConn
+	files bool
+	key   string // pending start key of the next entry
+	value string
+	entry *LibraryEntry
+	err   error
+	done  bool
+}
+
+// Next advances to the next entry, returning false at the end of the listing or on error.
+//
+// Entries MPD sent before failing with an ACK are returned before Next
+// reports the error.
+func (it *LibraryIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	if it.key == "" {
+		// first entry
+		if !it.read() {
+			return false
+		}
+		if it.done {
+			return false
+		}
+	}
+
+	key, value := it.key, it.value
+	attrs := mpd.Attrs{strings.ToLower(key): value}
+	for {
+		if !it.read() {
+			var ackErr *AckError
+			if !errors.As(it.err, &ackErr) {
+				return false
+			}
+			// MPD only sends complete entries before an ACK; the error is
+			// reported by the next call
+			break
+		}
+		if it.done || isLibraryStartKey(it.key) {
+			break
+		}
+		attrs[strings.ToLower(it.key)] = it.value
+	}
+
+	it.entry = parseLibraryEntry(strings.ToLower(key), attrs, it.files)
+	return true
+}
+
+// read reads the next pair into key/value, setting done on the final OK.
+func (it *LibraryIterator) read() bool {
+	key, value, ok, err := it.conn.readPair()
+	if err != nil {
+		it.err = err
+		it.finish()
+		return false
+	} else if ok {
+		it.key, it.value = "", ""
+		it.finish()
+		return true
+	}
+	it.key, it.value = key, value
+	return true
+}
+
+func (it *LibraryIterator) finish() {
+	if !it.done {
+		it.done = true
+		_ = it.conn.close()
+	}
+}
+
+// Entry returns the current entry.
+func (it *LibraryIterator) Entry() *LibraryEntry {
+	return it.entry
+}
+
+// Err returns the error that ended the listing, if any.
+func (it *LibraryIterator) Err() error {
+	return it.err
+}
+
+// Close releases the connection of an iterator that was not read until its end.
+func (it *LibraryIterator) Close() {
+	it.finish()
+}
+
+// All reads the remaining entries into a slice.
+func (it *LibraryIterator) All() ([]*LibraryEntry, error) {
+	defer it.Close()
+
+	var entries []*LibraryEntry
+	for it.Next() {
+		entries = append(entries, it.Entry())
+	}
+	return entries, it.Err()
+}
+
+func isLibraryStartKey(key string) bool {
+	switch strings.ToLower(key) {
+	case "file", "directory", "playlist":
+		return true
+	default:
+		return false
+	}
+}
+
+func parseLibraryEntry(key string, attrs mpd.Attrs, files bool) *LibraryEntry {
+	switch key {
+	case "directory":
+		return &LibraryEntry{Directory: &Directory{Path: attrs["directory"], LastModified: attrs["last-modified"]}}
+	case "playlist":
+		return &LibraryEntry{Playlist: &StoredPlaylist{Name: attrs["playlist"], LastModified: attrs["last-modified"]}}
+	default:
+		if files {
+			size, _ := strconv.ParseInt(attrs["size"], 10, 64)
+			return &LibraryEntry{File: &File{Name: attrs["file"], Size: size, LastModified: attrs["last-modified"]}}
+		}
+		return &LibraryEntry{Song: ParsePlaylistEntryAttrs(attrs)}
+	}
+}
+
+// TagValue is one value of a tag listing, together with the values of the
+// tags it was grouped by.
+type TagValue struct {
+	Value  string
+	Groups map[Tag]string
+}
+
+// Library provides access to the music database of a ReconnectingClient.
+//
+// Listings use a separate connection, so that large responses can be streamed
+// without blocking the commands run via Do().
+type Library struct {
+	client *ReconnectingClient
+}
+
+func NewLibrary(client *ReconnectingClient) *Library {
+	return &Library{client: client}
+}
+
+func (l *Library) dial() (*rawConn, error) {
+	return l.client.dialRaw()
+}
+
+func (l *Library) iterate(files bool, format string, args ...interface{}) *LibraryIterator {
+	conn, err := l.dial()
+	if err != nil {
+		return &LibraryIterator{err: err, done: true}
+	}
+	it := &LibraryIterator{conn: conn, files: files}
+	if err := conn.command(format, args...); err != nil {
+		it.err = err
+		it.finish()
+	}
+	return it
+}
+
+// LsInfo lists the directories, songs and playlists directly contained in the
+// directory uri. The root directory is "".
+func (l *Library) LsInfo(uri string) ([]*LibraryEntry, error) {
+	return l.iterate(false, "lsinfo %s", uri).All()
+}
+
+// ListAllInfo streams the directories and songs contained in the directory uri, recursively.
+func (l *Library) ListAllInfo(uri string) *LibraryIterator {
+	return l.iterate(false, "listallinfo %s", uri)
+}
+
+// ListFiles lists the files and directories in the directory uri, including
+// files that are not recognized as songs.
+func (l *Library) ListFiles(uri string) ([]*LibraryEntry, error) {
+	return l.iterate(true, "listfiles %s", uri).All()
+}
+
+// Find streams the songs in the database matching filter, case-sensitively.
+//
+// Unlike the Find function, it lists the songs on a separate connection, so
+// they carry all tags even if the client restricts them with WithTagTypes.
+func (l *Library) Find(filter Filter, options ...SearchOption) *LibraryIterator {
+	o := newSearchOptions(options)
+	args, err := filterArgs(l.client, "find", filter, o)
+	if err != nil {
+		return &LibraryIterator{err: err, done: true}
+	}
+	return l.iterate(false, "find %s"+o.args(), args)
+}
+
+// List lists the unique values of tag among the songs matching filter
+// (which may be nil), grouped by the groups tags.
+//
+// For example, List(TagAlbum, nil, TagAlbumArtist, TagDate) returns every
+// album together with its album artist and date.
+func (l *Library) List(tag Tag, filter Filter, groups ...Tag) ([]*TagValue, error) {
+	if f, ok := filter.(*andFilter); ok && len(f.filters) == 0 {
+		// And() matches all songs
+		filter = nil
+	} else if filter != nil && isEmptyFilter(filter) {
+		return nil, fmt.Errorf("list: %w", ErrEmptyFilter)
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	var cmd strings.Builder
+	cmd.WriteString("list ")
+	cmd.WriteString(string(tag))
+	if filter != nil {
+		cmd.WriteByte(' ')
+		cmd.WriteString(quote(filter.String()))
+	}
+	for _, group := range groups {
+		cmd.WriteString(" group ")
+		cmd.WriteString(string(group))
+	}
+	if err := conn.command("%s", mpd.Quoted(cmd.String())); err != nil {
+		return nil, err
+	}
+
+	var values []*TagValue
+	current := make(map[Tag]string, len(groups))
+	for {
+		key, value, ok, err := conn.readPair()
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return values, nil
+		}
+
+		if strings.EqualFold(key, string(tag)) {
+			groupValues := make(map[Tag]string, len(current))
+			for k, v := range current {
+				groupValues[k] = v
+			}
+			values = append(values, &TagValue{Value: value, Groups: groupValues})
+			continue
+		}
+		// MPD prints every group level before descending into it, so the
+		// inner group values are always refreshed when an outer one changes
+		for _, group := range groups {
+			if strings.EqualFold(key, string(group)) {
+				current[group] = value
+				break
+			}
+		}
+	}
+}
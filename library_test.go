@@ -0,0 +1,198 @@
+package mmpd_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+// entryName returns the path of the directory, song, playlist or file entry.
+func entryName(entry *mmpd.LibraryEntry) string {
+	switch {
+	case entry.Directory != nil:
+		return "directory " + entry.Directory.Path
+	case entry.Song != nil:
+		return "song " + entry.Song.File
+	case entry.Playlist != nil:
+		return "playlist " + entry.Playlist.Name
+	default:
+		return "file " + entry.File.Name
+	}
+}
+
+// sideConnectionsClosed waits until only the main connection of the client is left.
+func sideConnectionsClosed(t *testing.T, srv *mpdtest.Server) {
+	t.Helper()
+
+	eventually(t, "side connections closed", func() bool { return srv.Connections() == 1 })
+}
+
+func TestLibraryListAllInfo(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	library := mmpd.NewLibrary(client)
+
+	want := []string{"directory a", "song a/1.flac", "song a/2.flac", "song a/3.flac", "directory b", "song b/1.flac"}
+	it := library.ListAllInfo("")
+	defer it.Close()
+	for idx := 0; it.Next(); idx++ {
+		if idx >= len(want) {
+			t.Fatalf("unexpected %s", entryName(it.Entry()))
+		}
+		if got := entryName(it.Entry()); got != want[idx] {
+			t.Errorf("entry %d: got %s, want %s", idx, got, want[idx])
+		}
+		if song := it.Entry().Song; song != nil && song.File == "b/1.flac" && (song.Title != "Uno" || song.Artist != "B") {
+			t.Errorf("song %+v", song)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if it.Next() {
+		t.Error("Next after the end of the listing")
+	}
+	sideConnectionsClosed(t, srv)
+
+	entries, err := library.LsInfo("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entryName(entries[0]) != "song a/1.flac" {
+		t.Errorf("lsinfo a: %v", entries)
+	}
+}
+
+func TestLibraryIteratorClose(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	it := mmpd.NewLibrary(client).ListAllInfo("")
+	if !it.Next() || entryName(it.Entry()) != "directory a" {
+		t.Fatalf("first entry %v, error %v", it.Entry(), it.Err())
+	}
+	it.Close()
+	if it.Next() {
+		t.Errorf("Next after Close returned %s", entryName(it.Entry()))
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	sideConnectionsClosed(t, srv)
+
+	// the client keeps working
+	if err := client.Do(mmpd.Ping); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLibraryIteratorError(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	library := mmpd.NewLibrary(client)
+
+	// MPD fails halfway through the listing
+	srv.Handle("listallinfo", func([]string) ([]string, error) {
+		return []string{"directory: a", "file: a/1.flac", "Title: One"},
+			&mmpd.AckError{Code: mmpd.AckSystem, Message: "Output buffer is full"}
+	})
+	it := library.ListAllInfo("")
+	defer it.Close()
+	var names []string
+	for it.Next() {
+		names = append(names, entryName(it.Entry()))
+	}
+	if len(names) != 2 || names[1] != "song a/1.flac" {
+		t.Errorf("entries before the error: %v", names)
+	}
+	var ackErr *mmpd.AckError
+	if err := it.Err(); !errors.As(err, &ackErr) || ackErr.Code != mmpd.AckSystem || ackErr.Command != "listallinfo" {
+		t.Errorf("got %v, want the ACK", err)
+	}
+	sideConnectionsClosed(t, srv)
+
+	if _, err := library.LsInfo("missing"); !errors.As(err, &ackErr) || ackErr.Code != mmpd.AckNoExist {
+		t.Errorf("lsinfo of a missing directory: %v", err)
+	}
+}
+
+func TestLibraryListFiles(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	srv.Handle("listfiles", func([]string) ([]string, error) {
+		return []string{
+			"directory: live", "Last-Modified: 2024-01-02T03:04:05Z",
+			"file: cover.jpg", "size: 12345", "Last-Modified: 2024-01-01T00:00:00Z",
+			"file: 1.flac", "size: 67890",
+		}, nil
+	})
+	entries, err := mmpd.NewLibrary(client).ListFiles("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("%d entries", len(entries))
+	}
+	if dir := entries[0].Directory; dir == nil || dir.Path != "live" || dir.LastModified != "2024-01-02T03:04:05Z" {
+		t.Errorf("directory %+v", entries[0])
+	}
+	if file := entries[1].File; file == nil || file.Name != "cover.jpg" || file.Size != 12345 || file.LastModified != "2024-01-01T00:00:00Z" {
+		t.Errorf("file %+v", entries[1])
+	}
+	if file := entries[2].File; file == nil || file.Name != "1.flac" || file.Size != 67890 {
+		t.Errorf("file %+v", entries[2])
+	}
+}
+
+func TestLibraryListGroups(t *testing.T) {
+	srv := startServerWith(t, mpdtest.WithDatabase(
+		mpdtest.NewSong("p/1.flac", "AlbumArtist", "P", "Date", "2001", "Album", "Alpha"),
+		mpdtest.NewSong("p/2.flac", "AlbumArtist", "P", "Date", "2003", "Album", "Beta"),
+		mpdtest.NewSong("p/3.flac", "AlbumArtist", "P", "Date", "2003", "Album", "Gamma"),
+		mpdtest.NewSong("q/1.flac", "AlbumArtist", "Q", "Date", "2003", "Album", "Alpha"),
+	))
+	client := connect(t, srv)
+	library := mmpd.NewLibrary(client)
+
+	want := []struct{ albumArtist, date, album string }{
+		{"P", "2001", "Alpha"}, {"P", "2003", "Beta"}, {"P", "2003", "Gamma"}, {"Q", "2003", "Alpha"},
+	}
+	check := func(what string, values []*mmpd.TagValue) {
+		t.Helper()
+		if len(values) != len(want) {
+			t.Fatalf("%s: %d values", what, len(values))
+		}
+		for idx, value := range values {
+			if value.Value != want[idx].album || value.Groups[mmpd.TagAlbumArtist] != want[idx].albumArtist ||
+				value.Groups[mmpd.TagDate] != want[idx].date {
+				t.Errorf("%s: value %d is %+v, want %+v", what, idx, value, want[idx])
+			}
+		}
+	}
+
+	values, err := library.List(mmpd.TagAlbum, nil, mmpd.TagAlbumArtist, mmpd.TagDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("list", values)
+
+	// only the group levels that changed are repeated
+	srv.Handle("list", func([]string) ([]string, error) {
+		return []string{
+			"AlbumArtist: P", "Date: 2001", "Album: Alpha",
+			"Date: 2003", "Album: Beta", "Album: Gamma",
+			"AlbumArtist: Q", "Date: 2003", "Album: Alpha",
+		}, nil
+	})
+	values, err = library.List(mmpd.TagAlbum, nil, mmpd.TagAlbumArtist, mmpd.TagDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("sparse list", values)
+	if got := receivedCommands(srv, "list"); len(got) != 2 || got[1] != "list Album group AlbumArtist group Date" {
+		t.Errorf("received %v", got)
+	}
+}
@@ -0,0 +1,452 @@
+package mmpd
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/linkdata/deadlock"
+)
+
+// libraryIndexVersion is increased whenever the persisted format changes.
+const libraryIndexVersion = 4
+
+type LibraryIndexOption func(*LibraryIndex)
+
+// WithLibraryIndexFile persists the index to file, and loads it from there on startup.
+func WithLibraryIndexFile(file string) LibraryIndexOption {
+	return func(li *LibraryIndex) {
+		li.file = file
+	}
+}
+
+// WithIncrementalLimit sets the maximum number of songs fetched one by one
+// during an incremental refresh before falling back to a full rebuild.
+func WithIncrementalLimit(limit int) LibraryIndexOption {
+	return func(li *LibraryIndex) {
+		li.incrementalLimit = limit
+	}
+}
+
+// LibraryIndex is an in-process mirror of the music database.
+//
+// It is built from listallinfo, refreshed when the database changes and
+// queried locally with the same Filter model as Find and Search.
+type LibraryIndex struct {
+	client            *ReconnectingClient
+	library           *Library
+	file              string
+	incrementalLimit  int
+	lock              deadlock.RWMutex
+	songs             map[string]*PlaylistEntry
+	lastModified      string
+	refreshLock       deadlock.Mutex
+	subsystemListener *SubsystemsChangedListener
+	statusListener    *StatusChangedListener
+}
+
+// persistedLibraryIndex is the on-disk representation of a LibraryIndex.
+type persistedLibraryIndex struct {
+	Version      int
+	LastModified string
+	Songs        []*PlaylistEntry
+}
+
+func NewLibraryIndex(client *ReconnectingClient, options ...LibraryIndexOption) (*LibraryIndex, error) {
+	li := &LibraryIndex{
+		client:           client,
+		library:          NewLibrary(client),
+		incrementalLimit: 500,
+		songs:            make(map[string]*PlaylistEntry),
+	}
+	for _, option := range options {
+		option(li)
+	}
+
+	if li.file != "" {
+		if err := li.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("mpd: loading library index from %s failed: %v\n", li.file, err)
+		}
+	}
+
+	li.subsystemListener = NewSubsystemsChangedListener(func(client *ReconnectingClient, subsystems []Subsystem) {
+		for _, subsystem := range subsystems {
+			if subsystem == SubsystemDatabase {
+				go li.refreshAndLog()
+				return
+			}
+		}
+	})
+	client.SubsystemsChangedListeners.Add(li.subsystemListener)
+
+	// without idle, a finished database update is only visible in the status
+	var updating atomic.Bool
+	li.statusListener = NewStatusChangedListener(func(client *ReconnectingClient, status *Status) {
+		if updating.Swap(status.UpdatingDB != "") && status.UpdatingDB == "" {
+			go li.refreshAndLog()
+		}
+	})
+	client.StatusChangedListeners.Add(li.statusListener)
+
+	go li.refreshAndLog()
+	return li, nil
+}
+
+// Close stops following database changes.
+func (li *LibraryIndex) Close() {
+	li.client.SubsystemsChangedListeners.Remove(li.subsystemListener)
+	li.client.StatusChangedListeners.Remove(li.statusListener)
+}
+
+// Len returns the number of songs in the index.
+func (li *LibraryIndex) Len() int {
+	li.lock.RLock()
+	defer li.lock.RUnlock()
+
+	return len(li.songs)
+}
+
+// Song returns the song with the given URI, or nil if it is not in the index.
+func (li *LibraryIndex) Song(file string) *PlaylistEntry {
+	li.lock.RLock()
+	defer li.lock.RUnlock()
+
+	return li.songs[file]
+}
+
+// Find returns the songs matching filter, case-sensitively, like the find command.
+func (li *LibraryIndex) Find(filter Filter, options ...SearchOption) []*PlaylistEntry {
+	return li.query(filter, false, options)
+}
+
+// Search returns the songs matching filter, ignoring case, like the search command.
+func (li *LibraryIndex) Search(filter Filter, options ...SearchOption) []*PlaylistEntry {
+	return li.query(filter, true, options)
+}
+
+func (li *LibraryIndex) query(filter Filter, foldCase bool, options []SearchOption) []*PlaylistEntry {
+	o := newSearchOptions(options)
+
+	li.lock.RLock()
+	var result []*PlaylistEntry
+	for _, song := range li.songs {
+		if filter == nil || filter.match(song, foldCase) {
+			result = append(result, song)
+		}
+	}
+	li.lock.RUnlock()
+
+	// database order first, so the sort below is deterministic
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].File < result[j].File
+	})
+	if o.sort != "" {
+		sort.SliceStable(result, func(i, j int) bool {
+			c := compareSongs(result[i], result[j], o.sort)
+			if o.desc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	start, end := o.start, o.end
+	if start > len(result) {
+		start = len(result)
+	}
+	if end < 0 || end > len(result) {
+		end = len(result)
+	}
+	if end < start {
+		end = start
+	}
+	return result[start:end]
+}
+
+// compareSongs compares a and b by tag, ordering numbered tags numerically.
+func compareSongs(a, b *PlaylistEntry, tag Tag) int {
+	switch tag {
+	case TagTrack:
+		return a.TrackNumbering.Compare(b.TrackNumbering)
+	case TagDisc:
+		return a.DiscNumbering.Compare(b.DiscNumbering)
+	case TagMovementNumber:
+		return a.MovementNumbering.Compare(b.MovementNumbering)
+	default:
+		return strings.Compare(sortValue(a, tag), sortValue(b, tag))
+	}
+}
+
+// sortValue returns the value songs are sorted by, falling back from the
+// *Sort tags to their plain counterparts like MPD does.
+func sortValue(song *PlaylistEntry, tag Tag) string {
+	if value := song.TagValue(tag); value != "" {
+		return value
+	}
+	if plain, ok := strings.CutSuffix(string(tag), "Sort"); ok {
+		return song.TagValue(Tag(plain))
+	}
+	return ""
+}
+
+func (li *LibraryIndex) refreshAndLog() {
+	if err := li.Refresh(); err != nil {
+		fmt.Printf("mpd: refreshing library index failed: %v\n", err)
+	}
+}
+
+// Refresh brings the index up to date with the database.
+//
+// If the index is not empty, only the songs modified since the last refresh
+// are fetched, unless that would be more than the incremental limit. When
+// songs were deleted or old files added, this takes a listall of the whole
+// database in addition.
+func (li *LibraryIndex) Refresh() error {
+	li.refreshLock.Lock()
+	defer li.refreshLock.Unlock()
+
+	t0 := li.client.clock.Now()
+	var err error
+	if li.Len() == 0 {
+		err = li.rebuild()
+	} else if err = li.update(); err != nil {
+		fmt.Printf("mpd: incremental library index refresh failed: %v; rebuilding\n", err)
+		err = li.rebuild()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("mpd: library index refreshed with %d songs after %s\n", li.Len(), li.client.clock.Now().Sub(t0).String())
+
+	if li.file != "" {
+		return li.save()
+	}
+	return nil
+}
+
+// rebuild replaces the index by a full listallinfo.
+func (li *LibraryIndex) rebuild() error {
+	songs := make(map[string]*PlaylistEntry)
+	it := li.library.ListAllInfo("")
+	defer it.Close()
+	for it.Next() {
+		if song := it.Entry().Song; song != nil {
+			songs[song.File] = song
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	li.lock.Lock()
+	li.songs = songs
+	li.lastModified = maxLastModified(songs)
+	li.lock.Unlock()
+	return nil
+}
+
+// errIncrementalLimit makes update fall back to a full rebuild.
+var errIncrementalLimit = errors.New("too many new songs for incremental refresh")
+
+// update applies the changes since the last refresh. Songs modified since
+// then are fetched with modified-since. If the database then holds as many
+// songs as the index, nothing else changed and the update is done.
+// Otherwise the names of all files in the database are fetched with
+// listall, to drop deleted songs and to find new songs with an older
+// modification time.
+//
+// A deletion and the addition of an old file in the same database update
+// cancel out in the song count; they are only picked up by a later update
+// that lists all files, or by a rebuild.
+func (li *LibraryIndex) update() error {
+	li.lock.RLock()
+	since := li.lastModified
+	li.lock.RUnlock()
+	sinceTime, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return err
+	}
+
+	changed, err := li.find(ModifiedSince(sinceTime))
+	if err != nil {
+		return err
+	}
+	count, err := li.songCount()
+	if err != nil {
+		return err
+	}
+
+	li.lock.RLock()
+	changedFiles := make(map[string]struct{}, len(changed))
+	n := len(li.songs)
+	for _, song := range changed {
+		changedFiles[song.File] = struct{}{}
+		if _, ok := li.songs[song.File]; !ok {
+			n++
+		}
+	}
+	li.lock.RUnlock()
+	if n == count {
+		li.apply(nil, changed)
+		return nil
+	}
+
+	files := make(map[string]struct{})
+	it := li.library.iterate(false, "listall %s", "")
+	defer it.Close()
+	for it.Next() {
+		if song := it.Entry().Song; song != nil {
+			files[song.File] = struct{}{}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	li.lock.RLock()
+	var missing []string
+	for file := range files {
+		if _, ok := li.songs[file]; !ok {
+			if _, ok := changedFiles[file]; !ok {
+				missing = append(missing, file)
+			}
+		}
+	}
+	li.lock.RUnlock()
+
+	if len(missing) > li.incrementalLimit {
+		return errIncrementalLimit
+	}
+	for _, file := range missing {
+		songs, err := li.find(FileEquals(file))
+		if err != nil {
+			return err
+		}
+		changed = append(changed, songs...)
+	}
+	li.apply(files, changed)
+	return nil
+}
+
+// apply stores the changed songs, and drops the songs not in files unless
+// files is nil.
+func (li *LibraryIndex) apply(files map[string]struct{}, changed []*PlaylistEntry) {
+	li.lock.Lock()
+	defer li.lock.Unlock()
+
+	if files != nil {
+		for file := range li.songs {
+			if _, ok := files[file]; !ok {
+				delete(li.songs, file)
+			}
+		}
+	}
+	for _, song := range changed {
+		li.songs[song.File] = song
+	}
+	li.lastModified = maxLastModified(li.songs)
+}
+
+// songCount returns the number of songs in the database.
+func (li *LibraryIndex) songCount() (int, error) {
+	var count int
+	err := li.client.DoIdempotent(func(client *ReconnectingClient) error {
+		stats, err := client.Stats()
+		if err != nil {
+			return err
+		}
+		count, err = strconv.Atoi(stats["songs"])
+		return err
+	})
+	return count, err
+}
+
+// find returns the songs matching filter with all their tags, which the
+// main connection may be restricted to a few of.
+func (li *LibraryIndex) find(filter Filter) ([]*PlaylistEntry, error) {
+	var songs []*PlaylistEntry
+	it := li.library.Find(filter)
+	defer it.Close()
+	for it.Next() {
+		if song := it.Entry().Song; song != nil {
+			songs = append(songs, song)
+		}
+	}
+	return songs, it.Err()
+}
+
+func maxLastModified(songs map[string]*PlaylistEntry) string {
+	var latest time.Time
+	for _, song := range songs {
+		if t, err := time.Parse(time.RFC3339, song.LastModified); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest.UTC().Format(time.RFC3339)
+}
+
+func (li *LibraryIndex) load() error {
+	f, err := os.Open(li.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var persisted persistedLibraryIndex
+	if err := gob.NewDecoder(f).Decode(&persisted); err != nil {
+		return err
+	}
+	if persisted.Version != libraryIndexVersion {
+		return fmt.Errorf("unsupported library index version %d", persisted.Version)
+	}
+
+	songs := make(map[string]*PlaylistEntry, len(persisted.Songs))
+	for _, song := range persisted.Songs {
+		songs[song.File] = song
+	}
+
+	li.lock.Lock()
+	li.songs = songs
+	li.lastModified = persisted.LastModified
+	li.lock.Unlock()
+
+	fmt.Printf("mpd: loaded library index with %d songs from %s\n", len(songs), li.file)
+	return nil
+}
+
+// save writes the index to a temporary file that replaces the index file,
+// so a crash never leaves a truncated index behind.
+func (li *LibraryIndex) save() error {
+	li.lock.RLock()
+	persisted := persistedLibraryIndex{
+		Version:      libraryIndexVersion,
+		LastModified: li.lastModified,
+		Songs:        make([]*PlaylistEntry, 0, len(li.songs)),
+	}
+	for _, song := range li.songs {
+		persisted.Songs = append(persisted.Songs, song)
+	}
+	li.lock.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(li.file), filepath.Base(li.file)+".*")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(&persisted); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), li.file)
+}
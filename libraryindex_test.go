@@ -0,0 +1,206 @@
+package mmpd_test
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+func TestLibraryIndexUpdateWithTagTypes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index")
+	songs := []mpdtest.Song{
+		mpdtest.NewSong("a.flac", "Album", "A", "Title", "One", "Last-Modified", "2024-05-01T10:00:00Z"),
+		mpdtest.NewSong("b.flac", "Album", "B", "Title", "Two", "Last-Modified", "2024-05-02T10:00:00Z"),
+	}
+
+	srv := startServerWith(t, mpdtest.WithDatabase(songs[1]))
+	client := connect(t, srv, mmpd.WithTagTypes(mmpd.TagTitle))
+	li, err := mmpd.NewLibraryIndex(client, mmpd.WithLibraryIndexFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "index", func() bool { return li.Len() == 1 })
+	li.Close()
+	if err := li.Refresh(); err != nil { // waits for the initial refresh and saves
+		t.Fatal(err)
+	}
+
+	// a.flac is older than the index, so the update fetches it by name
+	srv = startServerWith(t, mpdtest.WithDatabase(songs...))
+	client = connect(t, srv, mmpd.WithTagTypes(mmpd.TagTitle))
+	li, err = mmpd.NewLibraryIndex(client, mmpd.WithLibraryIndexFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer li.Close()
+	eventually(t, "update", func() bool { return li.Len() == 2 })
+	if song := li.Song("a.flac"); song.Album != "A" || song.Title != "One" {
+		t.Errorf("updated song lacks tags: %+v", song)
+	}
+}
+
+func TestLibraryIndexPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index")
+	srv := startServerWith(t, mpdtest.WithDatabase(
+		mpdtest.NewSong("a.flac", "Title", "One", "Track", "A1", "Disc", "1/2", "duration", "181.123456",
+			"Format", "96000:24:2", "Last-Modified", "2024-05-01T10:00:00Z"),
+	))
+	client := connect(t, srv)
+
+	li, err := mmpd.NewLibraryIndex(client, mmpd.WithLibraryIndexFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	li.Close()
+	if err := li.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	want := li.Song("a.flac")
+
+	// a client that never connects, so the index is only loaded
+	offline, err := mmpd.NewReconnectingClient("tcp", "127.0.0.1:1", mmpd.WithKeepalive(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer offline.Close()
+	loaded, err := mmpd.NewLibraryIndex(offline, mmpd.WithLibraryIndexFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+
+	got := loaded.Song("a.flac")
+	if got == nil || !got.Equals(want) || got.Length() != 181123456*time.Microsecond {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestLibraryIndexOldVersion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := struct {
+		Version      int
+		LastModified string
+		Songs        []*mmpd.PlaylistEntry
+	}{1, "2030-01-01T00:00:00Z", []*mmpd.PlaylistEntry{{File: "gone.flac"}}}
+	if err := gob.NewEncoder(f).Encode(&old); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	srv := startServer(t)
+	li, err := mmpd.NewLibraryIndex(connect(t, srv), mmpd.WithLibraryIndexFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer li.Close()
+	eventually(t, "rebuild", func() bool { return li.Len() == len(testSongs) })
+	if li.Song("gone.flac") != nil {
+		t.Error("song of the old index was kept")
+	}
+}
+
+// indexSongs returns songs 1.flac to n.flac, modified on consecutive days of May 2024.
+func indexSongs(n int) []mpdtest.Song {
+	songs := make([]mpdtest.Song, n)
+	for idx := range songs {
+		songs[idx] = mpdtest.NewSong(fmt.Sprintf("%d.flac", idx+1), "Title", fmt.Sprint(idx+1),
+			"Last-Modified", fmt.Sprintf("2024-05-%02dT10:00:00Z", idx+1))
+	}
+	return songs
+}
+
+// saveIndex saves the index of a server with songs to file.
+func saveIndex(t *testing.T, file string, songs ...mpdtest.Song) {
+	t.Helper()
+
+	srv := startServerWith(t, mpdtest.WithDatabase(songs...))
+	li, err := mmpd.NewLibraryIndex(connect(t, srv), mmpd.WithLibraryIndexFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	li.Close()
+	if err := li.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// updateIndex loads the index from file and updates it from a server with songs.
+func updateIndex(t *testing.T, file string, want int, options []mmpd.LibraryIndexOption, songs ...mpdtest.Song) (*mpdtest.Server, *mmpd.LibraryIndex) {
+	t.Helper()
+
+	srv := startServerWith(t, mpdtest.WithDatabase(songs...))
+	li, err := mmpd.NewLibraryIndex(connect(t, srv), append([]mmpd.LibraryIndexOption{mmpd.WithLibraryIndexFile(file)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(li.Close)
+	eventually(t, "update", func() bool { return li.Len() == want })
+	return srv, li
+}
+
+func TestLibraryIndexUpdateNewSongs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index")
+	songs := indexSongs(3)
+	saveIndex(t, file, songs[:2]...)
+
+	// 3.flac is newer than the index, which modified-since finds on its own
+	srv, li := updateIndex(t, file, 3, nil, songs...)
+	if song := li.Song("3.flac"); song == nil || song.Title != "3" {
+		t.Errorf("new song %+v", song)
+	}
+	if got := receivedCommands(srv, "listall"); len(got) != 0 {
+		t.Errorf("received %v", got)
+	}
+	if got := receivedCommands(srv, "listallinfo"); len(got) != 0 {
+		t.Errorf("received %v", got)
+	}
+}
+
+func TestLibraryIndexUpdateDeletions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index")
+	songs := indexSongs(4)
+	saveIndex(t, file, songs[:3]...)
+
+	// 2.flac is deleted, 4.flac added
+	srv, li := updateIndex(t, file, 3, nil, songs[0], songs[2], songs[3])
+	eventually(t, "deletion", func() bool { return li.Song("2.flac") == nil })
+	for _, file := range []string{"1.flac", "3.flac", "4.flac"} {
+		if li.Song(file) == nil {
+			t.Errorf("%s missing", file)
+		}
+	}
+	if got := receivedCommands(srv, "listall"); len(got) != 1 {
+		t.Errorf("received %v", got)
+	}
+	if got := receivedCommands(srv, "listallinfo"); len(got) != 0 {
+		t.Errorf("received %v", got)
+	}
+}
+
+func TestLibraryIndexUpdateLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index")
+	songs := indexSongs(4)
+	saveIndex(t, file, songs[3])
+
+	// 1.flac to 3.flac are older than the index, and more than the limit
+	srv, li := updateIndex(t, file, 4, []mmpd.LibraryIndexOption{mmpd.WithIncrementalLimit(2)}, songs...)
+	if song := li.Song("1.flac"); song == nil || song.Title != "1" {
+		t.Errorf("old song %+v", song)
+	}
+	if got := receivedCommands(srv, "listallinfo"); len(got) != 1 {
+		t.Errorf("no rebuild after exceeding the limit: %v", got)
+	}
+	if got := receivedCommands(srv, "find"); len(got) != 1 {
+		t.Errorf("songs fetched one by one: %v", got)
+	}
+}
@@ -0,0 +1,358 @@
+package mmpd
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// OverflowPolicy decides what happens to an event for a listener whose queue
+// is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest drops the oldest queued event.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest drops the new event.
+	OverflowDropNewest
+	// OverflowCoalesce replaces all queued events with the new one whenever
+	// an event is added, so a slow listener only sees the latest state.
+	OverflowCoalesce
+	// OverflowBlock makes Notify wait until the listener made room. The
+	// client notifies while holding its connectLock, so a blocked listener
+	// must not run commands.
+	OverflowBlock
+)
+
+// DefaultListenerQueueSize is the number of events queued for a listener.
+const DefaultListenerQueueSize = 64
+
+type listenerConfig struct {
+	queueSize int
+	overflow  OverflowPolicy
+
+	// the fields a StatusFieldsChangedListener is notified about, all if 0
+	fields StatusField
+
+	// shared by listeners in several sets, to keep their events in order
+	queue *eventQueue
+}
+
+type ListenerOption func(*listenerConfig)
+
+// WithQueueSize sets the number of events queued for the listener.
+func WithQueueSize(size int) ListenerOption {
+	return func(config *listenerConfig) {
+		config.queueSize = max(size, 1)
+	}
+}
+
+// WithOverflow sets what happens when the queue of the listener is full.
+func WithOverflow(policy OverflowPolicy) ListenerOption {
+	return func(config *listenerConfig) {
+		config.overflow = policy
+	}
+}
+
+// WithStatusFields notifies a StatusFieldsChangedListener only of changes to
+// any of fields, e.g. to ignore the Elapsed updates during playback:
+//
+//	client.StatusFieldsChangedListeners.Add(mmpd.NewStatusFieldsChangedListener(
+//		func(client *mmpd.ReconnectingClient, change *mmpd.StatusChange) {
+//			...
+//		}), mmpd.WithStatusFields(mmpd.StatusState|mmpd.StatusVolume))
+//
+// Other changes are not queued for the listener, so they don't wake it up.
+// The option has no effect on other listeners.
+func WithStatusFields(fields StatusField) ListenerOption {
+	return func(config *listenerConfig) {
+		config.fields = fields
+	}
+}
+
+// ListenerQueue is an event queue shared by listeners of several sets, see
+// WithListenerQueue.
+type ListenerQueue struct {
+	queue *eventQueue
+}
+
+// NewListenerQueue returns a queue for WithListenerQueue. WithQueueSize and
+// WithOverflow apply to the queue as a whole.
+func NewListenerQueue(options ...ListenerOption) *ListenerQueue {
+	config := listenerConfig{queueSize: DefaultListenerQueueSize}
+	for _, option := range options {
+		option(&config)
+	}
+	config.fields, config.queue = 0, nil
+	return &ListenerQueue{queue: newEventQueue("ListenerQueue", config)}
+}
+
+// WithListenerQueue delivers the events of the listener through queue, one
+// at a time and in the order they were produced together with the events of
+// the other listeners using queue, e.g. a status change before the current
+// song change it caused:
+//
+//	queue := mmpd.NewListenerQueue()
+//	client.StatusChangedListeners.Add(statusListener, mmpd.WithListenerQueue(queue))
+//	client.CurrentSongChangedListeners.Add(currentSongListener, mmpd.WithListenerQueue(queue))
+//
+// WithQueueSize and WithOverflow are ignored for the listener.
+func WithListenerQueue(queue *ListenerQueue) ListenerOption {
+	return func(config *listenerConfig) {
+		config.queue = queue.queue
+	}
+}
+
+// ListenerSet provides synchronized access to a set of listeners.
+//
+// Each listener has its own queue, unless added WithListenerQueue, so a slow
+// listener does not hold up the others, and receives the events in the
+// order they were passed to Notify.
+type ListenerSet[T comparable] struct {
+	lock sync.RWMutex
+	set  map[T]*queuedListener
+}
+
+func NewListenerSet[T comparable]() *ListenerSet[T] {
+	return &ListenerSet[T]{
+		set: make(map[T]*queuedListener),
+	}
+}
+
+// Add adds a listener, or changes the options of a listener added before.
+func (l *ListenerSet[T]) Add(e T, options ...ListenerOption) {
+	config := listenerConfig{queueSize: DefaultListenerQueueSize}
+	for _, option := range options {
+		option(&config)
+	}
+
+	l.lock.Lock()
+	old, ok := l.set[e]
+	if ok && config.queue == nil && !old.shared {
+		// keep the events queued already
+		old.queue.configure(old, config)
+		l.lock.Unlock()
+		return
+	}
+	ql := &queuedListener{queue: config.queue, fields: config.fields, shared: config.queue != nil}
+	if ql.queue == nil {
+		ql.queue = newEventQueue(fmt.Sprintf("%T", e), config)
+	}
+	l.set[e] = ql
+	l.lock.Unlock()
+
+	if ok {
+		// not holding the lock, which the running callback may need
+		old.queue.remove(old)
+	}
+}
+
+// Remove removes a listener and discards its queued events. If a callback of
+// the listener is running, Remove waits for it to return, so none runs after
+// Remove returned. Callbacks delivered through the same queue may call Remove,
+// e.g. a listener removing itself, which does not wait for the calling
+// callback.
+func (l *ListenerSet[T]) Remove(e T) {
+	l.lock.Lock()
+	ql, ok := l.set[e]
+	delete(l.set, e)
+	l.lock.Unlock()
+
+	if ok {
+		ql.queue.remove(ql)
+	}
+}
+
+// Notify queues notifyFn for each listener and returns without waiting for
+// the callbacks, unless a listener with OverflowBlock has a full queue.
+func (l *ListenerSet[T]) Notify(notifyFn func(l T)) {
+	l.notifyFields(0, notifyFn)
+}
+
+// notifyFields is Notify for a change of the changed status fields, which
+// skips the listeners added WithStatusFields for other fields. Notify passes
+// 0 to notify all listeners.
+func (l *ListenerSet[T]) notifyFields(changed StatusField, notifyFn func(l T)) {
+	// the lock is not held while pushing, which may block with OverflowBlock
+	l.lock.RLock()
+	listeners := make(map[T]*queuedListener, len(l.set))
+	for e, ql := range l.set {
+		listeners[e] = ql
+	}
+	l.lock.RUnlock()
+
+	for e, ql := range listeners {
+		if changed == 0 || ql.queue.wants(ql, changed) {
+			ql.queue.push(ql, func() { notifyFn(e) })
+		}
+	}
+}
+
+// queuedListener is a listener of a ListenerSet. Its fields other than queue
+// and shared are guarded by the lock of the queue.
+type queuedListener struct {
+	queue   *eventQueue
+	shared  bool
+	fields  StatusField
+	removed bool
+}
+
+// queuedEvent is a callback of a listener waiting for delivery.
+type queuedEvent struct {
+	listener *queuedListener
+	notifyFn func()
+}
+
+// eventQueue delivers the events of one or more listeners from a goroutine
+// that runs while events are queued.
+type eventQueue struct {
+	name string
+
+	lock     sync.Mutex
+	cond     sync.Cond
+	config   listenerConfig
+	pending  []queuedEvent
+	running  bool
+	overflow bool
+
+	// the listener whose callback is running, and the goroutine running it
+	delivering *queuedListener
+	deliverer  uint64
+}
+
+func newEventQueue(name string, config listenerConfig) *eventQueue {
+	q := &eventQueue{name: name, config: config}
+	q.cond.L = &q.lock
+	return q
+}
+
+func (q *eventQueue) push(ql *queuedListener, notifyFn func()) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.config.overflow == OverflowCoalesce {
+		q.pending = q.pending[:0]
+	}
+	for !ql.removed && len(q.pending) >= q.config.queueSize {
+		switch q.config.overflow {
+		case OverflowBlock:
+			q.cond.Wait()
+			continue
+		case OverflowDropNewest:
+			q.logOverflow()
+			return
+		default:
+			q.logOverflow()
+			q.pending = q.pending[1:]
+		}
+	}
+	if ql.removed {
+		return
+	}
+
+	q.pending = append(q.pending, queuedEvent{listener: ql, notifyFn: notifyFn})
+	if !q.running {
+		q.running = true
+		go q.deliver()
+	}
+}
+
+// configure changes the options of the listener and its own queue.
+func (q *eventQueue) configure(ql *queuedListener, config listenerConfig) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.config = config
+	ql.fields = config.fields
+	q.cond.Broadcast()
+}
+
+// wants reports whether the listener is notified of a change of the changed
+// status fields.
+func (q *eventQueue) wants(ql *queuedListener, changed StatusField) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return ql.fields == 0 || ql.fields&changed != 0
+}
+
+// logOverflow logs the first dropped event after the queue had room again.
+// Must be called with the lock held.
+func (q *eventQueue) logOverflow() {
+	if !q.overflow {
+		q.overflow = true
+		fmt.Printf("mpd: listener %s is too slow, dropping events\n", q.name)
+	}
+}
+
+func (q *eventQueue) deliver() {
+	id := goroutineID()
+	for {
+		q.lock.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.lock.Unlock()
+			return
+		}
+		event := q.pending[0]
+		q.pending[0] = queuedEvent{}
+		q.pending = q.pending[1:]
+		if len(q.pending) == 0 {
+			q.overflow = false
+		}
+		q.cond.Broadcast()
+		if event.listener.removed {
+			q.lock.Unlock()
+			continue
+		}
+		q.delivering, q.deliverer = event.listener, id
+		q.lock.Unlock()
+
+		event.notifyFn()
+
+		q.lock.Lock()
+		q.delivering = nil
+		q.cond.Broadcast()
+		q.lock.Unlock()
+	}
+}
+
+// remove discards the queued events of the listener, stops queueing new ones
+// and waits for its running callback, unless called from the callback.
+func (q *eventQueue) remove(ql *queuedListener) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ql.removed = true
+	pending := q.pending[:0]
+	for _, event := range q.pending {
+		if event.listener != ql {
+			pending = append(pending, event)
+		}
+	}
+	clear(q.pending[len(pending):])
+	q.pending = pending
+	q.cond.Broadcast()
+
+	if q.delivering == ql && q.deliverer != goroutineID() {
+		for q.delivering == ql {
+			q.cond.Wait()
+		}
+	}
+}
+
+// goroutineID returns the ID of the calling goroutine, which Go only exposes
+// in stack traces.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// "goroutine 18 [running]:"
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if end := bytes.IndexByte(buf, ' '); end >= 0 {
+		buf = buf[:end]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
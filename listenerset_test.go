@@ -0,0 +1,156 @@
+package mmpd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+)
+
+type testListener struct {
+	name string
+}
+
+// finishes fails the test unless fn returns within a few seconds.
+func finishes(t *testing.T, what string, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s blocked", what)
+	}
+}
+
+func TestListenerQueueOrder(t *testing.T) {
+	statuses, songs := mmpd.NewListenerSet[*testListener](), mmpd.NewListenerSet[*testListener]()
+	queue := mmpd.NewListenerQueue(mmpd.WithQueueSize(100))
+	statuses.Add(&testListener{"status"}, mmpd.WithListenerQueue(queue))
+	songs.Add(&testListener{"song"}, mmpd.WithListenerQueue(queue))
+
+	events := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		set := statuses
+		if i%2 == 1 {
+			set = songs
+		}
+		set.Notify(func(*testListener) {
+			// give later events a chance to overtake
+			time.Sleep(time.Duration(i%3) * time.Millisecond)
+			events <- i
+		})
+	}
+	for want := 0; want < 100; want++ {
+		if got := receive(t, events); got != want {
+			t.Fatalf("got event %d, want %d", got, want)
+		}
+	}
+}
+
+func TestListenerSetBlockedNotify(t *testing.T) {
+	set := mmpd.NewListenerSet[*testListener]()
+	blocked := &testListener{"blocked"}
+	release := make(chan struct{})
+	set.Add(blocked, mmpd.WithQueueSize(1), mmpd.WithOverflow(mmpd.OverflowBlock))
+
+	// the first event runs, the second fills the queue, the third blocks
+	notified := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			set.Notify(func(l *testListener) {
+				if l == blocked {
+					<-release
+				}
+			})
+		}
+		close(notified)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-notified:
+		t.Fatal("Notify did not block")
+	default:
+	}
+
+	other := &testListener{"other"}
+	finishes(t, "Add", func() { set.Add(other) })
+	// Remove unblocks Notify, but waits for the running callback
+	removed := make(chan struct{})
+	go func() {
+		set.Remove(blocked)
+		close(removed)
+	}()
+	receive(t, notified)
+	select {
+	case <-removed:
+		t.Fatal("Remove returned while the callback was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	receive(t, removed)
+
+	called := make(chan *testListener, 10)
+	set.Notify(func(l *testListener) { called <- l })
+	if l := receive(t, called); l != other {
+		t.Errorf("%s notified", l.name)
+	}
+	select {
+	case l := <-called:
+		t.Errorf("%s notified after Remove", l.name)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestListenerQueueRemove(t *testing.T) {
+	a, b := mmpd.NewListenerSet[*testListener](), mmpd.NewListenerSet[*testListener]()
+	queue := mmpd.NewListenerQueue()
+	la, lb := &testListener{"a"}, &testListener{"b"}
+	a.Add(la, mmpd.WithListenerQueue(queue))
+	b.Add(lb, mmpd.WithListenerQueue(queue))
+
+	called := make(chan *testListener, 10)
+	a.Remove(la)
+	a.Notify(func(l *testListener) { called <- l })
+	b.Notify(func(l *testListener) { called <- l })
+	if l := receive(t, called); l != lb {
+		t.Errorf("%s notified", l.name)
+	}
+	select {
+	case l := <-called:
+		t.Errorf("%s notified after Remove", l.name)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestListenerSetRemoveFromCallback(t *testing.T) {
+	set := mmpd.NewListenerSet[*testListener]()
+	queue := mmpd.NewListenerQueue()
+	self, other := &testListener{"self"}, &testListener{"other"}
+	set.Add(self, mmpd.WithListenerQueue(queue))
+	set.Add(other, mmpd.WithListenerQueue(queue))
+
+	// removing listeners of the queue delivering the callback does not wait
+	// for the callback
+	done := make(chan struct{})
+	set.Notify(func(l *testListener) {
+		if l == self {
+			set.Remove(self)
+			set.Remove(other)
+			close(done)
+		}
+	})
+	receive(t, done)
+
+	called := make(chan *testListener, 10)
+	set.Notify(func(l *testListener) { called <- l })
+	select {
+	case l := <-called:
+		t.Errorf("%s notified after Remove", l.name)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,144 @@
+package mpdtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/linkdata/deadlock"
+	"github.com/mkke/mmpd"
+)
+
+// Clock is an mmpd.Clock whose time only moves with Advance, for
+// deterministic keepalive, reconnect and retry timing:
+//
+//	clock := mpdtest.NewClock(time.Now())
+//	client, err := mmpd.NewReconnectingClient(srv.Network(), srv.Addr(), mmpd.WithClock(clock))
+//	...
+//	clock.BlockUntil(1) // the keepalive ticker
+//	clock.Advance(time.Minute)
+type Clock struct {
+	lock    deadlock.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{}
+}
+
+type fakeTimer struct {
+	clock  *Clock
+	when   time.Time
+	period time.Duration // 0 for timers of After
+	ch     chan time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.add(d, 0).ch
+}
+
+func (c *Clock) NewTicker(d time.Duration) mmpd.Ticker {
+	if d <= 0 {
+		panic("mpdtest: non-positive interval for NewTicker")
+	}
+	return c.add(d, d)
+}
+
+func (c *Clock) add(d, period time.Duration) *fakeTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{clock: c, when: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 && period == 0 {
+		t.ch <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.signal()
+	return t
+}
+
+// Advance moves the time forward by d, firing the timers and tickers that
+// become due in order. Like time.Ticker, a ticker whose last tick was not
+// received yet drops ticks.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			break
+		}
+
+		t := c.timers[0]
+		c.now = t.when
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.timers = c.timers[1:]
+		}
+	}
+	c.now = end
+	c.signal()
+}
+
+// Timers returns the number of pending timers and tickers.
+func (c *Clock) Timers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, e.g. until
+// the client waits for its next reconnect attempt.
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.lock.Lock()
+		if len(c.timers) >= n {
+			c.lock.Unlock()
+			return
+		}
+		changed := c.changed
+		c.lock.Unlock()
+		<-changed
+	}
+}
+
+// signal wakes up BlockUntil. Must be called with the lock held.
+func (c *Clock) signal() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for idx, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:idx], c.timers[idx+1:]...)
+			c.signal()
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mpdtest
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/mkke/mmpd"
+)
+
+// defaultBinaryLimit is the chunk size of binary responses until the client
+// sends binarylimit, as in MPD.
+const defaultBinaryLimit = 8192
+
+func cmdBinaryLimit(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("binarylimit")
+	}
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit < 64 {
+		return nil, ackError(mmpd.AckArg, "Value too small")
+	}
+	c.binaryLimit = limit
+	return nil, nil
+}
+
+func cmdAlbumArt(c *conn, args []string) ([]string, error) {
+	file, offset, err := c.binaryArgs("albumart", args)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := c.server.albumArt[path.Dir(file)]
+	if !ok {
+		return nil, ackError(mmpd.AckNoExist, "No file exists")
+	}
+	return c.binaryChunk(data, offset, false)
+}
+
+func cmdReadPicture(c *conn, args []string) ([]string, error) {
+	file, offset, err := c.binaryArgs("readpicture", args)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := c.server.pictures[file]
+	if !ok {
+		// like MPD, a song without picture is no error
+		return nil, nil
+	}
+	return c.binaryChunk(data, offset, true)
+}
+
+// binaryArgs parses the song and offset arguments of albumart and
+// readpicture, and checks that the song exists.
+func (c *conn) binaryArgs(command string, args []string) (string, int, error) {
+	if len(args) != 2 {
+		return "", 0, wrongArgs(command)
+	}
+	offset, err := strconv.Atoi(args[1])
+	if err != nil || offset < 0 {
+		return "", 0, ackError(mmpd.AckArg, "Number expected: %s", args[1])
+	}
+	if songs, err := c.server.lookup(args[0]); err != nil || len(songs) != 1 || songs[0].File() != args[0] {
+		return "", 0, ackError(mmpd.AckNoExist, "No such file")
+	}
+	return args[0], offset, nil
+}
+
+// binaryChunk returns the response with the chunk of data at offset. The
+// data line is followed by the newline MPD sends after binary data.
+func (c *conn) binaryChunk(data []byte, offset int, withType bool) ([]string, error) {
+	if offset > len(data) {
+		return nil, ackError(mmpd.AckArg, "Offset too large")
+	}
+	limit := c.binaryLimit
+	if limit == 0 {
+		limit = defaultBinaryLimit
+	}
+	chunk := data[offset:min(offset+limit, len(data))]
+
+	lines := []string{fmt.Sprintf("size: %d", len(data))}
+	if withType {
+		lines = append(lines, "type: "+http.DetectContentType(data))
+	}
+	return append(lines, fmt.Sprintf("binary: %d", len(chunk)), string(chunk)), nil
+}
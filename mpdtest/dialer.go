@@ -0,0 +1,122 @@
+package mpdtest
+
+import (
+	"net"
+
+	"github.com/linkdata/deadlock"
+)
+
+// Dialer is an mmpd.Dialer that injects connection failures:
+//
+//	dialer := mpdtest.NewDialer()
+//	client, err := mmpd.NewReconnectingClient(srv.Network(), srv.Addr(), mmpd.WithDialer(dialer))
+//	...
+//	dialer.SetFailure(errors.New("refused")) // reconnects fail
+//	dialer.Sever()                           // drop the current connections
+//
+// Severing from a Server handler drops the connection while the command is
+// running.
+type Dialer struct {
+	lock    deadlock.Mutex
+	dialer  net.Dialer
+	failure error
+	hang    chan struct{}
+	dials   int
+	conns   map[net.Conn]struct{}
+}
+
+func NewDialer() *Dialer {
+	return &Dialer{conns: make(map[net.Conn]struct{})}
+}
+
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	d.lock.Lock()
+	d.dials++
+	failure, hang := d.failure, d.hang
+	d.lock.Unlock()
+
+	if hang != nil {
+		<-hang
+	}
+	if failure != nil {
+		return nil, failure
+	}
+
+	conn, err := d.dialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	d.lock.Lock()
+	d.conns[conn] = struct{}{}
+	d.lock.Unlock()
+	return &dialedConn{Conn: conn, dialer: d}, nil
+}
+
+// SetFailure makes the following dials fail with err, or succeed again if
+// err is nil.
+func (d *Dialer) SetFailure(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.failure = err
+}
+
+// Hang makes the following dials block until Release is called.
+func (d *Dialer) Hang() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.hang == nil {
+		d.hang = make(chan struct{})
+	}
+}
+
+// Release continues hanging dials.
+func (d *Dialer) Release() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.hang != nil {
+		close(d.hang)
+		d.hang = nil
+	}
+}
+
+// Sever closes all connections made by the dialer.
+func (d *Dialer) Sever() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for conn := range d.conns {
+		_ = conn.Close()
+	}
+	clear(d.conns)
+}
+
+// Dials returns the number of dial attempts.
+func (d *Dialer) Dials() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.dials
+}
+
+// Conns returns the number of open connections made by the dialer.
+func (d *Dialer) Conns() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return len(d.conns)
+}
+
+type dialedConn struct {
+	net.Conn
+	dialer *Dialer
+}
+
+func (dc *dialedConn) Close() error {
+	dc.dialer.lock.Lock()
+	delete(dc.dialer.conns, dc.Conn)
+	dc.dialer.lock.Unlock()
+	return dc.Conn.Close()
+}
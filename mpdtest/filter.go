@@ -0,0 +1,274 @@
+package mpdtest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkke/mmpd"
+)
+
+type matcher func(song Song) bool
+
+// parseQuery parses the filter of find, search and list: a filter expression,
+// or the legacy TAG VALUE pairs. The remaining arguments, like sort and
+// window, are returned as options. With fold, values are compared
+// case-insensitively, and legacy pairs match substrings like search does.
+func parseQuery(args []string, fold bool) (matcher, []string, error) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "(") {
+		p := &filterParser{s: args[0], fold: fold}
+		match, err := p.expression()
+		if err != nil {
+			return nil, nil, err
+		}
+		if p.skipSpace(); p.i < len(p.s) {
+			return nil, nil, ackError(mmpd.AckArg, "Unparsed garbage after expression")
+		}
+		return match, args[1:], nil
+	}
+
+	var matchers []matcher
+	for len(args) >= 2 && args[0] != "sort" && args[0] != "window" && args[0] != "position" {
+		op := "=="
+		if fold {
+			op = "contains"
+		}
+		match, err := tagMatcher(args[0], op, args[1], fold)
+		if err != nil {
+			return nil, nil, err
+		}
+		matchers = append(matchers, match)
+		args = args[2:]
+	}
+	return allOf(matchers), args, nil
+}
+
+func allOf(matchers []matcher) matcher {
+	return func(song Song) bool {
+		for _, match := range matchers {
+			if !match(song) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// filterParser parses filter expressions like
+//
+//	((Artist == "A") AND (!(Title contains 'live')))
+type filterParser struct {
+	s    string
+	i    int
+	fold bool
+}
+
+func (p *filterParser) expression() (matcher, error) {
+	p.skipSpace()
+	if !p.consume("(") {
+		return nil, ackError(mmpd.AckArg, "'(' expected")
+	}
+	p.skipSpace()
+
+	switch {
+	case p.consume("!"):
+		inner, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.close(); err != nil {
+			return nil, err
+		}
+		return func(song Song) bool { return !inner(song) }, nil
+
+	case strings.HasPrefix(p.s[p.i:], "("):
+		var matchers []matcher
+		for {
+			inner, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, inner)
+			p.skipSpace()
+			if p.consume(")") {
+				return allOf(matchers), nil
+			} else if !p.consume("AND") {
+				return nil, ackError(mmpd.AckArg, "'AND' expected")
+			}
+		}
+	}
+
+	name := p.word()
+	switch name {
+	case "base":
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		base := strings.TrimSuffix(value, "/") + "/"
+		return p.closeWith(func(song Song) bool { return strings.HasPrefix(song.File(), base) })
+
+	case "modified-since", "added-since":
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		since, err := parseTime(value)
+		if err != nil {
+			return nil, err
+		}
+		attr := "Last-Modified"
+		if name == "added-since" {
+			attr = "Added"
+		}
+		return p.closeWith(func(song Song) bool {
+			t, err := parseTime(song.value(attr))
+			return err == nil && t.After(since)
+		})
+	}
+
+	op := p.word()
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	match, err := tagMatcher(name, op, value, p.fold)
+	if err != nil {
+		return nil, err
+	}
+	return p.closeWith(match)
+}
+
+func (p *filterParser) closeWith(match matcher) (matcher, error) {
+	if err := p.close(); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+func (p *filterParser) close() error {
+	p.skipSpace()
+	if !p.consume(")") {
+		return ackError(mmpd.AckArg, "')' expected")
+	}
+	return nil
+}
+
+func (p *filterParser) skipSpace() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *filterParser) consume(token string) bool {
+	if strings.HasPrefix(p.s[p.i:], token) {
+		p.i += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) word() string {
+	p.skipSpace()
+	start := p.i
+	for p.i < len(p.s) && p.s[p.i] != ' ' && p.s[p.i] != ')' {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// value parses a quoted string with backslash escapes.
+func (p *filterParser) value() (string, error) {
+	p.skipSpace()
+	if p.i >= len(p.s) || (p.s[p.i] != '"' && p.s[p.i] != '\'') {
+		return "", ackError(mmpd.AckArg, "Quoted string expected")
+	}
+	quote := p.s[p.i]
+	p.i++
+
+	var value strings.Builder
+	for ; p.i < len(p.s) && p.s[p.i] != quote; p.i++ {
+		if p.s[p.i] == '\\' && p.i+1 < len(p.s) {
+			p.i++
+		}
+		value.WriteByte(p.s[p.i])
+	}
+	if p.i >= len(p.s) {
+		return "", ackError(mmpd.AckArg, "Closing quote not found")
+	}
+	p.i++
+	return value.String(), nil
+}
+
+// tagMatcher matches songs with a value of tag (or file, or any) for which
+// op value holds.
+func tagMatcher(tag, op, value string, fold bool) (matcher, error) {
+	if fold {
+		value = strings.ToLower(value)
+	}
+
+	var test func(v string) bool
+	negate := false
+	switch op {
+	case "==":
+		test = func(v string) bool { return v == value }
+	case "!=":
+		test, negate = func(v string) bool { return v == value }, true
+	case "contains":
+		test = func(v string) bool { return strings.Contains(v, value) }
+	case "!contains":
+		test, negate = func(v string) bool { return strings.Contains(v, value) }, true
+	case "starts_with":
+		test = func(v string) bool { return strings.HasPrefix(v, value) }
+	case "=~", "!~":
+		expr := value
+		if fold {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, ackError(mmpd.AckArg, "Invalid regular expression: %v", err)
+		}
+		test, negate = re.MatchString, op == "!~"
+	default:
+		return nil, ackError(mmpd.AckArg, "Unknown filter operator: %s", op)
+	}
+
+	if strings.EqualFold(tag, string(mmpd.TagPrio)) {
+		return nil, ackError(mmpd.AckArg, "prio filters are not supported")
+	} else if strings.EqualFold(tag, "AudioFormat") {
+		tag = "Format"
+	} else if !strings.EqualFold(tag, string(mmpd.TagFile)) && !strings.EqualFold(tag, string(mmpd.TagAny)) && !isTagType(tag) {
+		return nil, ackError(mmpd.AckArg, "Unknown filter type: %s", tag)
+	}
+
+	return func(song Song) bool {
+		values := song.values(tag)
+		if len(values) == 0 {
+			// a missing tag is an empty value
+			values = []string{""}
+		}
+		for _, v := range values {
+			if fold {
+				v = strings.ToLower(v)
+			}
+			if test(v) {
+				return !negate
+			}
+		}
+		return negate
+	}, nil
+}
+
+// parseTime parses an ISO 8601 time stamp or seconds since the epoch.
+func parseTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, ackError(mmpd.AckArg, "Invalid time stamp: %s", s)
+	}
+	return t, nil
+}
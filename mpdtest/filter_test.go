@@ -0,0 +1,51 @@
+package mpdtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mkke/mmpd"
+)
+
+// protocolQuote quotes an argument of a command line, see
+// https://mpd.readthedocs.io/en/latest/protocol.html#escaping-string-values.
+func protocolQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// FuzzFilterEscaping checks that values survive rendering a filter and
+// parsing it again like MPD does.
+func FuzzFilterEscaping(f *testing.F) {
+	for _, seed := range []string{"", "plain", `say "hi"`, `back\slash`, "it's", `\"'`, "(Artist == \"x\") AND", `trailing\`, "tab\tand ünïcode"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		if strings.ContainsAny(value, "\r\n") {
+			// the protocol has no way to send line breaks
+			t.Skip()
+		}
+
+		filter := mmpd.And(
+			mmpd.TagEquals(mmpd.TagArtist, value),
+			mmpd.TagStartsWith(mmpd.TagAlbum, value),
+			mmpd.Not(mmpd.TagContains(mmpd.TagTitle, value+"~")),
+		)
+		name, args, err := splitCommand("find " + protocolQuote(filter.String()))
+		if err != nil || name != "find" || len(args) != 1 {
+			t.Fatalf("splitting %q: %v %q", filter.String(), err, args)
+		}
+		match, rest, err := parseQuery(args, false)
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("parsing %q: %v %q", args[0], err, rest)
+		}
+
+		matching := NewSong("a.flac", "Artist", value, "Album", value+" (Deluxe)", "Title", value)
+		if !match(matching) {
+			t.Errorf("%s does not match %v", filter, matching)
+		}
+		other := NewSong("b.flac", "Artist", value+"x", "Album", value, "Title", value)
+		if match(other) {
+			t.Errorf("%s matches %v", filter, other)
+		}
+	})
+}
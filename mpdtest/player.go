@@ -0,0 +1,1276 @@
+package mpdtest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkke/mmpd"
+)
+
+// Song is a song of the database: its attributes as sent by MPD by name,
+// including "file", e.g. "Artist", "duration" or "Format".
+type Song map[string]string
+
+// NewSong returns a song with the given file and attribute name/value pairs.
+func NewSong(file string, attrs ...string) Song {
+	song := Song{"file": file}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		song[attrs[i]] = attrs[i+1]
+	}
+	return song
+}
+
+func (s Song) File() string {
+	return s["file"]
+}
+
+// values returns the values of attribute name, matched case-insensitively.
+// "any" returns the values of all tags.
+func (s Song) values(name string) []string {
+	var values []string
+	for key, value := range s {
+		if strings.EqualFold(key, name) || (strings.EqualFold(name, string(mmpd.TagAny)) && isTagType(key)) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (s Song) value(name string) string {
+	if values := s.values(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// tagTypes are the tag types supported by the server.
+var tagTypes = []mmpd.Tag{
+	mmpd.TagArtist, mmpd.TagArtistSort, mmpd.TagAlbum, mmpd.TagAlbumSort, mmpd.TagAlbumArtist,
+	mmpd.TagAlbumArtistSort, mmpd.TagTitle, mmpd.TagTitleSort, mmpd.TagTrack, mmpd.TagName,
+	mmpd.TagGenre, mmpd.TagMood, mmpd.TagDate, mmpd.TagOriginalDate, mmpd.TagComposer,
+	mmpd.TagComposerSort, mmpd.TagPerformer, mmpd.TagConductor, mmpd.TagWork, mmpd.TagEnsemble,
+	mmpd.TagMovement, mmpd.TagMovementNumber, mmpd.TagLocation, mmpd.TagGrouping, mmpd.TagComment,
+	mmpd.TagDisc, mmpd.TagLabel, mmpd.TagMusicbrainzArtistId, mmpd.TagMusicbrainzAlbumId,
+	mmpd.TagMusicbrainzAlbumArtistId, mmpd.TagMusicbrainzTrackId, mmpd.TagMusicbrainzReleaseGroupId,
+	mmpd.TagMusicbrainzReleaseTrackId, mmpd.TagMusicbrainzWorkId,
+}
+
+func isTagType(name string) bool {
+	for _, tag := range tagTypes {
+		if strings.EqualFold(string(tag), name) {
+			return true
+		}
+	}
+	return false
+}
+
+type queueItem struct {
+	song Song
+	id   int
+	prio int
+	rng  string
+
+	// the playlist version of the last change
+	version uint32
+}
+
+// player is the state of the server besides connections.
+type player struct {
+	db              []Song
+	queue           []*queueItem
+	nextId          int
+	playlistVersion uint32
+	state           mmpd.PlayerState
+	currentId       int
+	elapsed         time.Duration
+	volume          int
+	repeat          bool
+	random          bool
+	single          mmpd.OffOnOneshot
+	consume         mmpd.OffOnOneshot
+	crossfade       int
+	updateId        int
+	rand            *rand.Rand
+}
+
+func newPlayer() player {
+	return player{
+		nextId:          1,
+		playlistVersion: 1,
+		state:           mmpd.Stop,
+		volume:          50,
+		single:          mmpd.Off,
+		consume:         mmpd.Off,
+		// shuffles are the same in every run
+		rand: rand.New(rand.NewSource(1)),
+	}
+}
+
+// pos returns the position of the queue item with id, or -1.
+func (p *player) pos(id int) int {
+	for pos, item := range p.queue {
+		if item.id == id {
+			return pos
+		}
+	}
+	return -1
+}
+
+// nextPos returns the position of the song played after the current one, or -1.
+func (p *player) nextPos() int {
+	pos := p.pos(p.currentId)
+	switch {
+	case pos < 0:
+		return -1
+	case pos+1 < len(p.queue):
+		return pos + 1
+	case p.repeat:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// changed marks the queue items from position from, and items, as changed in
+// a new playlist version.
+func (p *player) changed(from int, items ...*queueItem) {
+	p.playlistVersion++
+	for _, item := range p.queue[min(from, len(p.queue)):] {
+		item.version = p.playlistVersion
+	}
+	for _, item := range items {
+		item.version = p.playlistVersion
+	}
+}
+
+func (p *player) insert(pos int, songs []Song) []*queueItem {
+	if pos < 0 || pos > len(p.queue) {
+		pos = len(p.queue)
+	}
+	items := make([]*queueItem, len(songs))
+	for idx, song := range songs {
+		items[idx] = &queueItem{song: song, id: p.nextId}
+		p.nextId++
+	}
+	p.queue = append(p.queue[:pos], append(items, p.queue[pos:]...)...)
+	p.changed(pos)
+	return items
+}
+
+func (p *player) remove(start, end int) {
+	if current := p.pos(p.currentId); current >= start && current < end {
+		p.currentId = 0
+		p.state = mmpd.Stop
+		p.elapsed = 0
+	}
+	p.queue = append(p.queue[:start], p.queue[end:]...)
+	p.changed(start)
+}
+
+func (p *player) play(pos int) {
+	p.currentId = p.queue[pos].id
+	p.state = mmpd.Play
+	p.elapsed = 0
+}
+
+func (p *player) stop() {
+	p.state = mmpd.Stop
+	p.elapsed = 0
+}
+
+// lookup returns the songs of the database below uri, a song for a stream
+// URL, or the songs of the whole database for "" or "/".
+func (p *player) lookup(uri string) ([]Song, error) {
+	uri = strings.TrimSuffix(uri, "/")
+	if strings.Contains(uri, "://") {
+		return []Song{NewSong(uri)}, nil
+	}
+
+	var songs []Song
+	for _, song := range p.db {
+		if uri == "" || song.File() == uri || strings.HasPrefix(song.File(), uri+"/") {
+			songs = append(songs, song)
+		}
+	}
+	if len(songs) == 0 {
+		return nil, ackError(mmpd.AckNoExist, "No such directory")
+	}
+	return songs, nil
+}
+
+type command func(c *conn, args []string) ([]string, error)
+
+// commands are the built-in commands; they run with the server lock held.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// connection
+		"ping":        func(c *conn, args []string) ([]string, error) { return nil, nil },
+		"password":    cmdPassword,
+		"commands":    cmdCommands,
+		"notcommands": cmdNotCommands,
+		"tagtypes":    cmdTagTypes,
+		"urlhandlers": func(c *conn, args []string) ([]string, error) {
+			return []string{"handler: http://", "handler: https://"}, nil
+		},
+		"decoders": func(c *conn, args []string) ([]string, error) {
+			return []string{"plugin: flac", "suffix: flac", "mime_type: audio/flac",
+				"plugin: mad", "suffix: mp3", "mime_type: audio/mpeg"}, nil
+		},
+		"binarylimit": cmdBinaryLimit,
+		"albumart":    cmdAlbumArt,
+		"readpicture": cmdReadPicture,
+
+		// status
+		"status":         cmdStatus,
+		"currentsong":    cmdCurrentSong,
+		"stats":          cmdStats,
+		"playlistinfo":   cmdPlaylistInfo,
+		"playlistid":     cmdPlaylistId,
+		"plchanges":      cmdPlChanges,
+		"plchangesposid": cmdPlChangesPosId,
+
+		// playback
+		"play":     cmdPlay,
+		"playid":   cmdPlayId,
+		"pause":    cmdPause,
+		"stop":     cmdStop,
+		"next":     cmdNext,
+		"previous": cmdPrevious,
+		"seek":     cmdSeek,
+		"seekid":   cmdSeekId,
+		"seekcur":  cmdSeekCur,
+
+		// options
+		"setvol":    cmdSetVol,
+		"volume":    cmdVolume,
+		"getvol":    cmdGetVol,
+		"repeat":    cmdRepeat,
+		"random":    cmdRandom,
+		"single":    cmdSingle,
+		"consume":   cmdConsume,
+		"crossfade": cmdCrossfade,
+
+		// queue
+		"add":      cmdAdd,
+		"addid":    cmdAddId,
+		"delete":   cmdDelete,
+		"deleteid": cmdDeleteId,
+		"clear":    cmdClear,
+		"move":     cmdMove,
+		"moveid":   cmdMoveId,
+		"swap":     cmdSwap,
+		"swapid":   cmdSwapId,
+		"shuffle":  cmdShuffle,
+		"prio":     cmdPrio,
+		"prioid":   cmdPrioId,
+		"rangeid":  cmdRangeId,
+
+		// database
+		"listall":     cmdListAll,
+		"listallinfo": cmdListAllInfo,
+		"lsinfo":      cmdLsInfo,
+		"find":        cmdFind,
+		"search":      cmdSearch,
+		"findadd":     cmdFindAdd,
+		"searchadd":   cmdSearchAdd,
+		"list":        cmdList,
+		"update":      cmdUpdate,
+		"rescan":      cmdUpdate,
+	}
+}
+
+func cmdPassword(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("password")
+	}
+	if c.server.password != "" && args[0] != c.server.password {
+		return nil, ackError(mmpd.AckPassword, "incorrect password")
+	}
+	c.authenticated = true
+	return nil, nil
+}
+
+func cmdCommands(c *conn, args []string) ([]string, error) {
+	var lines []string
+	for _, name := range c.server.commandNames() {
+		if c.authenticated || unrestricted[name] {
+			lines = append(lines, "command: "+name)
+		}
+	}
+	return lines, nil
+}
+
+func cmdNotCommands(c *conn, args []string) ([]string, error) {
+	var lines []string
+	for _, name := range c.server.commandNames() {
+		if !c.authenticated && !unrestricted[name] {
+			lines = append(lines, "command: "+name)
+		}
+	}
+	return lines, nil
+}
+
+func cmdTagTypes(c *conn, args []string) ([]string, error) {
+	if len(args) == 0 {
+		var lines []string
+		for _, tag := range tagTypes {
+			if c.tagTypes == nil || c.tagTypes[strings.ToLower(string(tag))] {
+				lines = append(lines, "tagtype: "+string(tag))
+			}
+		}
+		return lines, nil
+	}
+
+	for _, tag := range args[1:] {
+		if !isTagType(tag) {
+			return nil, ackError(mmpd.AckArg, "Unknown tag type: %s", tag)
+		}
+	}
+	switch args[0] {
+	case "all":
+		c.tagTypes = nil
+	case "clear":
+		c.tagTypes = make(map[string]bool)
+	case "enable":
+		if c.tagTypes != nil {
+			for _, tag := range args[1:] {
+				c.tagTypes[strings.ToLower(tag)] = true
+			}
+		}
+	case "disable":
+		if c.tagTypes == nil {
+			c.tagTypes = make(map[string]bool)
+			for _, tag := range tagTypes {
+				c.tagTypes[strings.ToLower(string(tag))] = true
+			}
+		}
+		for _, tag := range args[1:] {
+			delete(c.tagTypes, strings.ToLower(tag))
+		}
+	default:
+		return nil, ackError(mmpd.AckArg, "Unknown sub command")
+	}
+	return nil, nil
+}
+
+func cmdStatus(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	lines := []string{
+		"volume: " + strconv.Itoa(p.volume),
+		"repeat: " + boolString(p.repeat),
+		"random: " + boolString(p.random),
+		"single: " + string(p.single),
+		"consume: " + string(p.consume),
+		"partition: default",
+		fmt.Sprintf("playlist: %d", p.playlistVersion),
+		fmt.Sprintf("playlistlength: %d", len(p.queue)),
+		"mixrampdb: 0.000000",
+		"state: " + string(p.state),
+	}
+	if pos := p.pos(p.currentId); pos >= 0 {
+		lines = append(lines, fmt.Sprintf("song: %d", pos), fmt.Sprintf("songid: %d", p.currentId))
+		if p.state != mmpd.Stop {
+			song := p.queue[pos].song
+			duration, _ := strconv.ParseFloat(song["duration"], 64)
+			lines = append(lines,
+				fmt.Sprintf("time: %d:%d", int(p.elapsed.Round(time.Second).Seconds()), int(duration+0.5)),
+				fmt.Sprintf("elapsed: %.3f", p.elapsed.Seconds()),
+				fmt.Sprintf("duration: %.3f", duration),
+				"bitrate: 0")
+			if format := song["Format"]; format != "" {
+				lines = append(lines, "audio: "+format)
+			}
+		}
+	}
+	if next := p.nextPos(); next >= 0 {
+		lines = append(lines, fmt.Sprintf("nextsong: %d", next), fmt.Sprintf("nextsongid: %d", p.queue[next].id))
+	}
+	if p.crossfade > 0 {
+		lines = append(lines, fmt.Sprintf("xfade: %d", p.crossfade))
+	}
+	return lines, nil
+}
+
+func cmdCurrentSong(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	if pos := p.pos(p.currentId); pos >= 0 {
+		return c.queueItemLines(pos), nil
+	}
+	return nil, nil
+}
+
+func cmdStats(c *conn, args []string) ([]string, error) {
+	artists := map[string]bool{}
+	albums := map[string]bool{}
+	for _, song := range c.server.db {
+		artists[song.value("Artist")] = true
+		albums[song.value("Album")] = true
+	}
+	return []string{
+		fmt.Sprintf("artists: %d", len(artists)),
+		fmt.Sprintf("albums: %d", len(albums)),
+		fmt.Sprintf("songs: %d", len(c.server.db)),
+		"uptime: 0",
+		"playtime: 0",
+		"db_playtime: 0",
+		"db_update: 0",
+	}, nil
+}
+
+func cmdPlaylistInfo(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	start, end := 0, len(p.queue)
+	if len(args) > 0 {
+		var err error
+		if start, end, err = parseRange(args[0], len(p.queue)); err != nil {
+			return nil, err
+		}
+	}
+	var lines []string
+	for pos := start; pos < end; pos++ {
+		lines = append(lines, c.queueItemLines(pos)...)
+	}
+	return lines, nil
+}
+
+func cmdPlaylistId(c *conn, args []string) ([]string, error) {
+	if len(args) == 0 {
+		return cmdPlaylistInfo(c, nil)
+	}
+	pos, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return c.queueItemLines(pos), nil
+}
+
+func cmdPlChanges(c *conn, args []string) ([]string, error) {
+	var lines []string
+	err := c.server.eachChange(args, func(pos int) {
+		lines = append(lines, c.queueItemLines(pos)...)
+	})
+	return lines, err
+}
+
+func cmdPlChangesPosId(c *conn, args []string) ([]string, error) {
+	var lines []string
+	err := c.server.eachChange(args, func(pos int) {
+		lines = append(lines, fmt.Sprintf("cpos: %d", pos), fmt.Sprintf("Id: %d", c.server.queue[pos].id))
+	})
+	return lines, err
+}
+
+func (s *Server) eachChange(args []string, fn func(pos int)) error {
+	if len(args) == 0 {
+		return wrongArgs("plchanges")
+	}
+	version, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return ackError(mmpd.AckArg, "Number expected: %s", args[0])
+	}
+	for pos, item := range s.queue {
+		if uint64(item.version) > version {
+			fn(pos)
+		}
+	}
+	return nil
+}
+
+func cmdPlay(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	if len(args) == 0 {
+		if p.state == mmpd.Pause {
+			p.state = mmpd.Play
+		} else if pos := p.pos(p.currentId); pos >= 0 {
+			p.play(pos)
+		} else if len(p.queue) > 0 {
+			p.play(0)
+		}
+	} else {
+		pos, err := c.server.posArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		p.play(pos)
+	}
+	c.server.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdPlayId(c *conn, args []string) ([]string, error) {
+	if len(args) == 0 {
+		return cmdPlay(c, nil)
+	}
+	pos, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	c.server.play(pos)
+	c.server.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdPause(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	if p.state == mmpd.Stop {
+		return nil, nil
+	}
+	pause := p.state == mmpd.Play
+	if len(args) > 0 {
+		pause = args[0] == "1"
+	}
+	if pause {
+		p.state = mmpd.Pause
+	} else {
+		p.state = mmpd.Play
+	}
+	c.server.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdStop(c *conn, args []string) ([]string, error) {
+	c.server.stop()
+	c.server.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdNext(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	if p.state == mmpd.Stop {
+		return nil, nil
+	}
+	if next := p.nextPos(); next >= 0 {
+		state := p.state
+		p.play(next)
+		p.state = state
+	} else {
+		p.currentId = 0
+		p.stop()
+	}
+	c.server.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdPrevious(c *conn, args []string) ([]string, error) {
+	p := &c.server.player
+	if p.state == mmpd.Stop {
+		return nil, nil
+	}
+	pos := p.pos(p.currentId)
+	if pos > 0 {
+		pos--
+	}
+	state := p.state
+	p.play(pos)
+	p.state = state
+	c.server.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdSeek(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("seek")
+	}
+	pos, err := c.server.posArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return c.server.seek(pos, args[1])
+}
+
+func cmdSeekId(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("seekid")
+	}
+	pos, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return c.server.seek(pos, args[1])
+}
+
+func cmdSeekCur(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("seekcur")
+	}
+	p := &c.server.player
+	pos := p.pos(p.currentId)
+	if pos < 0 {
+		return nil, ackError(mmpd.AckPlayerSync, "Not playing")
+	}
+	if arg := args[0]; strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		offset, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, ackError(mmpd.AckArg, "Number expected: %s", arg)
+		}
+		elapsed := p.elapsed + time.Duration(offset*float64(time.Second))
+		return c.server.seek(pos, strconv.FormatFloat(max(elapsed, 0).Seconds(), 'f', -1, 64))
+	}
+	return c.server.seek(pos, args[0])
+}
+
+func (s *Server) seek(pos int, seconds string) ([]string, error) {
+	f, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || f < 0 {
+		return nil, ackError(mmpd.AckArg, "Number expected: %s", seconds)
+	}
+	state := s.state
+	if s.queue[pos].id != s.currentId || state == mmpd.Stop {
+		state = mmpd.Play
+	}
+	s.play(pos)
+	s.state = state
+	s.elapsed = time.Duration(f * float64(time.Second))
+	s.notify(mmpd.SubsystemPlayer)
+	return nil, nil
+}
+
+func cmdSetVol(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("setvol")
+	}
+	volume, err := strconv.Atoi(args[0])
+	if err != nil || volume < 0 || volume > 100 {
+		return nil, ackError(mmpd.AckArg, "Invalid volume value")
+	}
+	c.server.volume = volume
+	c.server.notify(mmpd.SubsystemMixer)
+	return nil, nil
+}
+
+func cmdVolume(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("volume")
+	}
+	change, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, ackError(mmpd.AckArg, "Integer expected: %s", args[0])
+	}
+	return cmdSetVol(c, []string{strconv.Itoa(min(max(c.server.volume+change, 0), 100))})
+}
+
+func cmdGetVol(c *conn, args []string) ([]string, error) {
+	return []string{"volume: " + strconv.Itoa(c.server.volume)}, nil
+}
+
+func cmdRepeat(c *conn, args []string) ([]string, error) {
+	return c.server.setBool(args, &c.server.repeat)
+}
+
+func cmdRandom(c *conn, args []string) ([]string, error) {
+	return c.server.setBool(args, &c.server.random)
+}
+
+func (s *Server) setBool(args []string, b *bool) ([]string, error) {
+	if len(args) != 1 || (args[0] != "0" && args[0] != "1") {
+		return nil, ackError(mmpd.AckArg, "Boolean (0/1) expected")
+	}
+	*b = args[0] == "1"
+	s.notify(mmpd.SubsystemOptions)
+	return nil, nil
+}
+
+func cmdSingle(c *conn, args []string) ([]string, error) {
+	return c.server.setOffOnOneshot(args, &c.server.single)
+}
+
+func cmdConsume(c *conn, args []string) ([]string, error) {
+	return c.server.setOffOnOneshot(args, &c.server.consume)
+}
+
+func (s *Server) setOffOnOneshot(args []string, v *mmpd.OffOnOneshot) ([]string, error) {
+	if len(args) != 1 || (args[0] != "0" && args[0] != "1" && args[0] != "oneshot") {
+		return nil, ackError(mmpd.AckArg, "Boolean (0/1) or \"oneshot\" expected")
+	}
+	*v = mmpd.ParseOffOnOneshot(args[0])
+	s.notify(mmpd.SubsystemOptions)
+	return nil, nil
+}
+
+func cmdCrossfade(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("crossfade")
+	}
+	seconds, err := strconv.Atoi(args[0])
+	if err != nil || seconds < 0 {
+		return nil, ackError(mmpd.AckArg, "Integer expected: %s", args[0])
+	}
+	c.server.crossfade = seconds
+	c.server.notify(mmpd.SubsystemOptions)
+	return nil, nil
+}
+
+func cmdAdd(c *conn, args []string) ([]string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, wrongArgs("add")
+	}
+	pos, err := c.server.insertPosArg(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	songs, err := c.server.lookup(args[0])
+	if err != nil {
+		return nil, err
+	}
+	c.server.insert(pos, songs)
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdAddId(c *conn, args []string) ([]string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, wrongArgs("addid")
+	}
+	pos, err := c.server.insertPosArg(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	songs, err := c.server.lookup(args[0])
+	if err != nil {
+		return nil, err
+	} else if len(songs) != 1 || (songs[0].File() != args[0] && !strings.Contains(args[0], "://")) {
+		return nil, ackError(mmpd.AckNoExist, "No such song")
+	}
+	items := c.server.insert(pos, songs)
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return []string{fmt.Sprintf("Id: %d", items[0].id)}, nil
+}
+
+func cmdDelete(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("delete")
+	}
+	start, end, err := parseRange(args[0], len(c.server.queue))
+	if err != nil {
+		return nil, err
+	}
+	c.server.remove(start, end)
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdDeleteId(c *conn, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, wrongArgs("deleteid")
+	}
+	pos, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	c.server.remove(pos, pos+1)
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdClear(c *conn, args []string) ([]string, error) {
+	c.server.remove(0, len(c.server.queue))
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdMove(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("move")
+	}
+	start, end, err := parseRange(args[0], len(c.server.queue))
+	if err != nil {
+		return nil, err
+	}
+	return c.server.move(start, end, args[1])
+}
+
+func cmdMoveId(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("moveid")
+	}
+	pos, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return c.server.move(pos, pos+1, args[1])
+}
+
+func (s *Server) move(start, end int, toArg string) ([]string, error) {
+	to, err := strconv.Atoi(toArg)
+	if err != nil || to < 0 || to+(end-start) > len(s.queue) {
+		return nil, ackError(mmpd.AckArg, "Bad song index")
+	}
+	items := append([]*queueItem(nil), s.queue[start:end]...)
+	rest := append(append([]*queueItem(nil), s.queue[:start]...), s.queue[end:]...)
+	s.queue = append(rest[:to], append(items, rest[to:]...)...)
+	s.changed(min(start, to))
+	s.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdSwap(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("swap")
+	}
+	pos1, err := c.server.posArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	pos2, err := c.server.posArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return c.server.swap(pos1, pos2)
+}
+
+func cmdSwapId(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("swapid")
+	}
+	pos1, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	pos2, err := c.server.posOfIdArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return c.server.swap(pos1, pos2)
+}
+
+func (s *Server) swap(pos1, pos2 int) ([]string, error) {
+	s.queue[pos1], s.queue[pos2] = s.queue[pos2], s.queue[pos1]
+	s.changed(len(s.queue), s.queue[pos1], s.queue[pos2])
+	s.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdShuffle(c *conn, args []string) ([]string, error) {
+	start, end := 0, len(c.server.queue)
+	if len(args) > 0 {
+		var err error
+		if start, end, err = parseRange(args[0], len(c.server.queue)); err != nil {
+			return nil, err
+		}
+	}
+	items := c.server.queue[start:end]
+	c.server.rand.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	c.server.changed(len(c.server.queue), items...)
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdPrio(c *conn, args []string) ([]string, error) {
+	if len(args) < 2 {
+		return nil, wrongArgs("prio")
+	}
+	prio, err := parsePrio(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var items []*queueItem
+	for _, arg := range args[1:] {
+		start, end, err := parseRange(arg, len(c.server.queue))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, c.server.queue[start:end]...)
+	}
+	return c.server.setPrio(prio, items)
+}
+
+func cmdPrioId(c *conn, args []string) ([]string, error) {
+	if len(args) < 2 {
+		return nil, wrongArgs("prioid")
+	}
+	prio, err := parsePrio(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var items []*queueItem
+	for _, arg := range args[1:] {
+		pos, err := c.server.posOfIdArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, c.server.queue[pos])
+	}
+	return c.server.setPrio(prio, items)
+}
+
+func (s *Server) setPrio(prio int, items []*queueItem) ([]string, error) {
+	for _, item := range items {
+		item.prio = prio
+	}
+	s.changed(len(s.queue), items...)
+	s.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func parsePrio(arg string) (int, error) {
+	prio, err := strconv.Atoi(arg)
+	if err != nil || prio < 0 || prio > 255 {
+		return 0, ackError(mmpd.AckArg, "Priority out of range: %s", arg)
+	}
+	return prio, nil
+}
+
+func cmdRangeId(c *conn, args []string) ([]string, error) {
+	if len(args) != 2 {
+		return nil, wrongArgs("rangeid")
+	}
+	pos, err := c.server.posOfIdArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	item := c.server.queue[pos]
+	if args[1] == ":" {
+		item.rng = ""
+	} else {
+		start, end, _ := strings.Cut(args[1], ":")
+		startSeconds, err := strconv.ParseFloat(start, 64)
+		if start == "" {
+			startSeconds, err = 0, nil
+		}
+		if err != nil {
+			return nil, ackError(mmpd.AckArg, "Bad range: %s", args[1])
+		}
+		item.rng = fmt.Sprintf("%.3f-", startSeconds)
+		if end != "" {
+			endSeconds, err := strconv.ParseFloat(end, 64)
+			if err != nil || endSeconds < startSeconds {
+				return nil, ackError(mmpd.AckArg, "Bad range: %s", args[1])
+			}
+			item.rng += fmt.Sprintf("%.3f", endSeconds)
+		}
+	}
+	c.server.changed(len(c.server.queue), item)
+	c.server.notify(mmpd.SubsystemPlaylist)
+	return nil, nil
+}
+
+func cmdListAll(c *conn, args []string) ([]string, error) {
+	return c.server.listAll(args, func(song Song) []string {
+		return []string{"file: " + song.File()}
+	})
+}
+
+func cmdListAllInfo(c *conn, args []string) ([]string, error) {
+	return c.server.listAll(args, c.songLines)
+}
+
+func (s *Server) listAll(args []string, songLines func(song Song) []string) ([]string, error) {
+	uri := ""
+	if len(args) > 0 {
+		uri = args[0]
+	}
+	songs, err := s.lookup(uri)
+	if err != nil && uri != "" {
+		return nil, err
+	}
+
+	var lines []string
+	seen := map[string]bool{}
+	for _, song := range songs {
+		// the directories leading to the song, not yet listed
+		dir := ""
+		for _, part := range strings.Split(song.File(), "/")[:strings.Count(song.File(), "/")] {
+			dir = strings.TrimPrefix(dir+"/"+part, "/")
+			if !seen[dir] && len(dir) > len(uri) {
+				seen[dir] = true
+				lines = append(lines, "directory: "+dir)
+			}
+		}
+		lines = append(lines, songLines(song)...)
+	}
+	return lines, nil
+}
+
+func cmdLsInfo(c *conn, args []string) ([]string, error) {
+	uri := ""
+	if len(args) > 0 {
+		uri = strings.Trim(args[0], "/")
+	}
+	songs, err := c.server.lookup(uri)
+	if err != nil && uri != "" {
+		return nil, err
+	}
+
+	prefix := uri
+	if prefix != "" {
+		prefix += "/"
+	}
+	var lines []string
+	seen := map[string]bool{}
+	for _, song := range songs {
+		name := strings.TrimPrefix(song.File(), prefix)
+		if dir, _, ok := strings.Cut(name, "/"); ok {
+			if !seen[dir] {
+				seen[dir] = true
+				lines = append(lines, "directory: "+prefix+dir)
+			}
+		} else if song.File() != uri || len(songs) == 1 {
+			lines = append(lines, c.songLines(song)...)
+		}
+	}
+	return lines, nil
+}
+
+func cmdFind(c *conn, args []string) ([]string, error) {
+	songs, err := c.server.query(args, false)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, song := range songs {
+		lines = append(lines, c.songLines(song)...)
+	}
+	return lines, nil
+}
+
+func cmdSearch(c *conn, args []string) ([]string, error) {
+	songs, err := c.server.query(args, true)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, song := range songs {
+		lines = append(lines, c.songLines(song)...)
+	}
+	return lines, nil
+}
+
+func cmdFindAdd(c *conn, args []string) ([]string, error) {
+	return c.server.queryAdd(args, false)
+}
+
+func cmdSearchAdd(c *conn, args []string) ([]string, error) {
+	return c.server.queryAdd(args, true)
+}
+
+func (s *Server) queryAdd(args []string, fold bool) ([]string, error) {
+	pos := -1
+	if n := len(args); n >= 2 && args[n-2] == "position" {
+		var err error
+		if pos, err = s.insertPosArg(args[n-1:]); err != nil {
+			return nil, err
+		}
+		args = args[:n-2]
+	}
+	songs, err := s.query(args, fold)
+	if err != nil {
+		return nil, err
+	}
+	if len(songs) > 0 {
+		s.insert(pos, songs)
+		s.notify(mmpd.SubsystemPlaylist)
+	}
+	return nil, nil
+}
+
+// query returns the songs of the database matching the filter in args,
+// sorted and windowed as requested.
+func (s *Server) query(args []string, fold bool) ([]Song, error) {
+	match, options, err := parseQuery(args, fold)
+	if err != nil {
+		return nil, err
+	}
+
+	var songs []Song
+	for _, song := range s.db {
+		if match(song) {
+			songs = append(songs, song)
+		}
+	}
+
+	for i := 0; i+1 < len(options); i += 2 {
+		switch options[i] {
+		case "sort":
+			tag, desc := strings.CutPrefix(options[i+1], "-")
+			sort.SliceStable(songs, func(a, b int) bool {
+				if desc {
+					return songs[a].value(tag) > songs[b].value(tag)
+				}
+				return songs[a].value(tag) < songs[b].value(tag)
+			})
+		case "window":
+			start, end, err := parseRange(options[i+1], len(songs))
+			if err != nil {
+				return nil, err
+			}
+			songs = songs[start:end]
+		default:
+			return nil, ackError(mmpd.AckArg, "Unknown argument: %s", options[i])
+		}
+	}
+	return songs, nil
+}
+
+func cmdList(c *conn, args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, wrongArgs("list")
+	}
+	tag := args[0]
+	args = args[1:]
+
+	var groups []string
+	for len(args) >= 2 && args[len(args)-2] == "group" {
+		groups = append([]string{args[len(args)-1]}, groups...)
+		args = args[:len(args)-2]
+	}
+	if len(args) == 1 && !strings.HasPrefix(args[0], "(") {
+		// list Album ARTIST
+		args = []string{string(mmpd.TagArtist), args[0]}
+	}
+	match, _, err := parseQuery(args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the distinct group values and tag value, in order
+	seen := map[string]bool{}
+	var rows [][]string
+	for _, song := range c.server.db {
+		if !match(song) {
+			continue
+		}
+		row := make([]string, 0, len(groups)+1)
+		for _, group := range groups {
+			row = append(row, song.value(group))
+		}
+		for _, value := range song.values(tag) {
+			key := strings.Join(append(row, value), "\x00")
+			if !seen[key] {
+				seen[key] = true
+				rows = append(rows, append(append([]string(nil), row...), value))
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return strings.Join(rows[i], "\x00") < strings.Join(rows[j], "\x00")
+	})
+
+	var lines []string
+	var last []string
+	for _, row := range rows {
+		groupsChanged := last == nil
+		for idx := range groups {
+			if last != nil && row[idx] != last[idx] {
+				groupsChanged = true
+			}
+		}
+		if groupsChanged {
+			for idx, group := range groups {
+				lines = append(lines, group+": "+row[idx])
+			}
+		}
+		lines = append(lines, tag+": "+row[len(row)-1])
+		last = row
+	}
+	return lines, nil
+}
+
+func cmdUpdate(c *conn, args []string) ([]string, error) {
+	c.server.updateId++
+	c.server.notify(mmpd.SubsystemUpdate, mmpd.SubsystemDatabase)
+	return []string{fmt.Sprintf("updating_db: %d", c.server.updateId)}, nil
+}
+
+// songLines returns the response lines of song, omitting disabled tag types.
+func (c *conn) songLines(song Song) []string {
+	lines := []string{"file: " + song.File()}
+	var keys []string
+	for key := range song {
+		if key == "file" || (c.tagTypes != nil && isTagType(key) && !c.tagTypes[strings.ToLower(key)]) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, key+": "+song[key])
+	}
+	return lines
+}
+
+func (c *conn) queueItemLines(pos int) []string {
+	item := c.server.queue[pos]
+	lines := c.songLines(item.song)
+	if item.rng != "" {
+		lines = append(lines, "Range: "+item.rng)
+	}
+	lines = append(lines, fmt.Sprintf("Pos: %d", pos), fmt.Sprintf("Id: %d", item.id))
+	if item.prio > 0 {
+		lines = append(lines, fmt.Sprintf("Prio: %d", item.prio))
+	}
+	return lines
+}
+
+func (s *Server) posArg(arg string) (int, error) {
+	pos, err := strconv.Atoi(arg)
+	if err != nil || pos < 0 || pos >= len(s.queue) {
+		return 0, ackError(mmpd.AckArg, "Bad song index")
+	}
+	return pos, nil
+}
+
+// insertPosArg returns the position given in args, or -1 for the end.
+func (s *Server) insertPosArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return -1, nil
+	}
+	pos, err := strconv.Atoi(args[0])
+	if err != nil || pos < 0 || pos > len(s.queue) {
+		return 0, ackError(mmpd.AckArg, "Bad song index")
+	}
+	return pos, nil
+}
+
+func (s *Server) posOfIdArg(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, ackError(mmpd.AckArg, "Integer expected: %s", arg)
+	}
+	pos := s.pos(id)
+	if pos < 0 {
+		return 0, ackError(mmpd.AckNoExist, "No such song")
+	}
+	return pos, nil
+}
+
+// parseRange parses a position "POS" or range "START:END" with an optional
+// END within a list of length n.
+func parseRange(arg string, n int) (int, int, error) {
+	startArg, endArg, isRange := strings.Cut(arg, ":")
+	start, err := strconv.Atoi(startArg)
+	if err != nil || start < 0 {
+		return 0, 0, ackError(mmpd.AckArg, "Bad song index")
+	}
+	end := start + 1
+	if isRange {
+		end = n
+		if endArg != "" {
+			if end, err = strconv.Atoi(endArg); err != nil {
+				return 0, 0, ackError(mmpd.AckArg, "Bad song index")
+			}
+			end = min(end, n)
+		}
+	}
+	if start > end || end > n || (!isRange && start >= n) {
+		return 0, 0, ackError(mmpd.AckArg, "Bad song index")
+	}
+	return start, end, nil
+}
+
+func wrongArgs(command string) error {
+	return ackError(mmpd.AckArg, "wrong number of arguments for \"%s\"", command)
+}
+
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,431 @@
+package mpdtest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fhs/gompd/v2/mpd"
+	"github.com/linkdata/deadlock"
+)
+
+// Recording is a protocol exchange recorded with mmpd.Recorder.
+type Recording struct {
+	// the connections, in the order they were opened
+	Connections []*RecordedConnection
+}
+
+type RecordedConnection struct {
+	Events []RecordedEvent
+}
+
+// RecordedEvent is a chunk of data sent on a connection.
+type RecordedEvent struct {
+	// set if the data was sent by the client, otherwise by MPD
+	FromClient bool
+
+	Data []byte
+}
+
+// ReadRecording parses a recording written by mmpd.Recorder.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	recording := &Recording{}
+	ids := map[int]*RecordedConnection{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		idField, rest, _ := strings.Cut(line, " ")
+		id, err := strconv.Atoi(idField)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid connection number '%s'", lineNo, idField)
+		}
+		conn, ok := ids[id]
+		if !ok {
+			conn = &RecordedConnection{}
+			ids[id] = conn
+			recording.Connections = append(recording.Connections, conn)
+		}
+
+		if rest == "closed" {
+			continue
+		}
+		dir, quoted, _ := strings.Cut(rest, " ")
+		data, err := strconv.Unquote(quoted)
+		if err != nil || (dir != ">" && dir != "<") {
+			return nil, fmt.Errorf("line %d: invalid event", lineNo)
+		}
+		conn.Events = append(conn.Events, RecordedEvent{FromClient: dir == ">", Data: []byte(data)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
+
+// stream returns the data sent by the client, or by MPD.
+func (rc *RecordedConnection) stream(fromClient bool) []byte {
+	var data []byte
+	for _, event := range rc.Events {
+		if event.FromClient == fromClient {
+			data = append(data, event.Data...)
+		}
+	}
+	return data
+}
+
+// Exchange is a command and the response of MPD.
+type Exchange struct {
+	// the command line, e.g. "status"; for command lists, the lines of the
+	// list joined with newlines
+	Command string
+
+	// the response lines, without the final OK
+	Response []string
+
+	// the ACK line if the command failed
+	Ack string
+}
+
+// Name returns the name of the command.
+func (e *Exchange) Name() string {
+	name, _, _ := strings.Cut(e.Command, " ")
+	return name
+}
+
+// Attrs returns the response as attributes, like mpd.Client does for
+// status or currentsong.
+func (e *Exchange) Attrs() mpd.Attrs {
+	attrs := mpd.Attrs{}
+	for _, line := range e.Response {
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
+
+// AttrsList returns the response as list of attributes, each starting with
+// startKey, like mpd.Client does for playlistinfo with "file".
+func (e *Exchange) AttrsList(startKey string) []mpd.Attrs {
+	var attrsList []mpd.Attrs
+	for _, line := range e.Response {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		if key == startKey || len(attrsList) == 0 {
+			attrsList = append(attrsList, mpd.Attrs{})
+		}
+		attrsList[len(attrsList)-1][key] = value
+	}
+	return attrsList
+}
+
+// Exchanges returns the commands of the connection with their responses.
+// Binary data, like cover art, is omitted from the response.
+func (rc *RecordedConnection) Exchanges() []Exchange {
+	commands := strings.Split(string(rc.stream(true)), "\n")
+	responses := bufio.NewReader(bytes.NewReader(rc.stream(false)))
+
+	// skip the greeting
+	if _, err := responses.ReadString('\n'); err != nil {
+		return nil
+	}
+
+	var exchanges []Exchange
+	for idx := 0; idx < len(commands); idx++ {
+		command := commands[idx]
+		switch {
+		case command == "" || command == "noidle":
+			// noidle has no response of its own
+			continue
+		case command == "command_list_begin" || command == "command_list_ok_begin":
+			var list []string
+			for idx++; idx < len(commands) && commands[idx] != "command_list_end"; idx++ {
+				list = append(list, commands[idx])
+			}
+			command = strings.Join(list, "\n")
+		}
+
+		exchange := Exchange{Command: command}
+		for {
+			line, err := responses.ReadString('\n')
+			if err != nil {
+				// the connection was closed before the response was complete
+				return append(exchanges, exchange)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "OK" {
+				break
+			} else if strings.HasPrefix(line, "ACK ") {
+				exchange.Ack = line
+				break
+			} else if length, ok := strings.CutPrefix(line, "binary: "); ok {
+				if n, err := strconv.Atoi(length); err == nil {
+					// the data and its terminating newline
+					_, _ = responses.Discard(n + 1)
+				}
+			}
+			exchange.Response = append(exchange.Response, line)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges
+}
+
+// Exchanges returns the exchanges of all connections with the command name,
+// or all exchanges if name is empty.
+func (r *Recording) Exchanges(name string) []Exchange {
+	var exchanges []Exchange
+	for _, conn := range r.Connections {
+		for _, exchange := range conn.Exchanges() {
+			if name == "" || exchange.Name() == name {
+				exchanges = append(exchanges, exchange)
+			}
+		}
+	}
+	return exchanges
+}
+
+// ReplayServer serves a recorded session back to clients.
+//
+// Each client connection is matched to the first unused recorded connection
+// whose first command is the same, so connections opened concurrently can be
+// replayed in a different order. The server then sends the recorded responses,
+// and checks that the client sends the recorded commands; see Err.
+//
+// Password commands match regardless of the password, so recordings with
+// redacted passwords can be replayed; clients authenticating first are
+// matched to the recorded connections in the order they were opened.
+type ReplayServer struct {
+	recording *Recording
+	listener  net.Listener
+
+	lock deadlock.Mutex
+	used []bool
+	errs []error
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewReplayServer starts a server replaying recording on a free loopback TCP port.
+func NewReplayServer(recording *Recording) (*ReplayServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &ReplayServer{
+		recording: recording,
+		listener:  listener,
+		used:      make([]bool, len(recording.Connections)),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *ReplayServer) Network() string {
+	return "tcp"
+}
+
+func (s *ReplayServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and waits for the connections to finish.
+func (s *ReplayServer) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.listener.Close()
+		s.wg.Wait()
+	})
+	return err
+}
+
+// Err returns the differences between the commands sent by clients and the
+// recording, or nil if there were none.
+func (s *ReplayServer) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return errors.Join(s.errs...)
+}
+
+// Unused returns the number of recorded connections not replayed.
+func (s *ReplayServer) Unused() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	unused := 0
+	for _, used := range s.used {
+		if !used {
+			unused++
+		}
+	}
+	return unused
+}
+
+func (s *ReplayServer) serve() {
+	defer s.wg.Done()
+
+	var conns []net.Conn
+	var connsLock deadlock.Mutex
+	defer func() {
+		connsLock.Lock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		connsLock.Unlock()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		connsLock.Lock()
+		conns = append(conns, conn)
+		connsLock.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			if err := s.replay(conn); err != nil {
+				s.lock.Lock()
+				s.errs = append(s.errs, err)
+				s.lock.Unlock()
+			}
+		}()
+	}
+}
+
+func (s *ReplayServer) replay(conn net.Conn) error {
+	s.lock.Lock()
+	var greeting []byte
+	for idx, recorded := range s.recording.Connections {
+		if !s.used[idx] {
+			greeting = leadingServerData(recorded)
+			break
+		}
+	}
+	s.lock.Unlock()
+	if greeting == nil {
+		return errors.New("no recorded connection left to replay")
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	first, err := r.ReadString('\n')
+	if err != nil {
+		// the client went away without sending a command
+		return nil
+	}
+
+	recorded := s.claim(first)
+	if recorded == nil {
+		return fmt.Errorf("no recorded connection starts with %q", first)
+	}
+
+	// the greeting and the first command are done
+	sent := []string{first}
+	events := recorded.Events
+	for len(events) > 0 && !events[0].FromClient {
+		events = events[1:]
+	}
+
+	// the commands of the client are compared line by line once the
+	// recording continues with a response, or ends
+	var expected []byte
+	check := func() error {
+		for _, want := range strings.SplitAfter(string(expected), "\n") {
+			if want == "" {
+				continue
+			}
+			var got string
+			if len(sent) > 0 {
+				got, sent = sent[0], sent[1:]
+			} else if !strings.HasSuffix(want, "\n") {
+				// the recording ends within the line
+				data := make([]byte, len(want))
+				n, err := io.ReadFull(r, data)
+				if got = string(data[:n]); err != nil {
+					return fmt.Errorf("expected %q, got %q: %w", want, got, err)
+				}
+			} else if got, err = r.ReadString('\n'); err != nil {
+				return fmt.Errorf("expected %q, got %q: %w", want, got, err)
+			}
+			if !sameCommand(want, got) {
+				return fmt.Errorf("expected %q, got %q", want, got)
+			}
+		}
+		expected = nil
+		return nil
+	}
+
+	for _, event := range events {
+		if event.FromClient {
+			expected = append(expected, event.Data...)
+			continue
+		}
+		if err := check(); err != nil {
+			return err
+		}
+		if _, err := conn.Write(event.Data); err != nil {
+			return err
+		}
+	}
+	return check()
+}
+
+// sameCommand reports whether the client sent the recorded command line.
+// Passwords are redacted by mmpd.Recorder, so any password matches.
+func sameCommand(recorded, sent string) bool {
+	if strings.HasPrefix(recorded, "password ") {
+		return strings.HasPrefix(sent, "password ")
+	}
+	return recorded == sent
+}
+
+// claim marks the first unused recorded connection with the first command as
+// used and returns it.
+func (s *ReplayServer) claim(first string) *RecordedConnection {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for idx, recorded := range s.recording.Connections {
+		line, _, _ := strings.Cut(string(recorded.stream(true)), "\n")
+		if !s.used[idx] && sameCommand(line+"\n", first) {
+			s.used[idx] = true
+			return recorded
+		}
+	}
+	return nil
+}
+
+// leadingServerData returns the data MPD sent before the first command, the greeting.
+func leadingServerData(rc *RecordedConnection) []byte {
+	var data []byte
+	for _, event := range rc.Events {
+		if event.FromClient {
+			break
+		}
+		data = append(data, event.Data...)
+	}
+	return data
+}
@@ -0,0 +1,572 @@
+// Package mpdtest provides an in-process MPD server for testing MPD clients.
+//
+// The server speaks the MPD protocol over a local TCP or unix socket, backed
+// by a simple stateful model: a song database with cover art, the queue, the
+// player state, options, idle notifications and password authentication.
+// Playback does not progress on its own; the elapsed time only changes by
+// seeking, so tests are deterministic.
+//
+//	srv, err := mpdtest.NewServer(mpdtest.WithDatabase(
+//		mpdtest.NewSong("a/1.flac", "Artist", "A", "Title", "One"),
+//		mpdtest.NewSong("a/2.flac", "Artist", "A", "Title", "Two"),
+//	))
+//	...
+//	defer srv.Close()
+//	client, err := mmpd.NewReconnectingClient(srv.Network(), srv.Addr(), mmpd.WithBlocking())
+//
+// Tests change the server state with Exec, which runs a command as if sent by
+// an authenticated client, and provoke failures with DisconnectAll and
+// SetAcceptConnections. Commands the server does not implement, or responses
+// a test needs to control, can be scripted with Handle.
+package mpdtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/linkdata/deadlock"
+	"github.com/mkke/mmpd"
+)
+
+// DefaultVersion is the protocol version announced by the server.
+const DefaultVersion = "0.23.5"
+
+// Handler implements a command. It receives the unquoted arguments and
+// returns the response lines ("key: value"), or an error; *mmpd.AckError is
+// sent with its code, other errors as ACK_ERROR_SYSTEM. Lines returned
+// together with an error are sent before the ACK, like MPD does for
+// commands failing halfway through their output.
+//
+// Handlers run without the server lock, so they may call Server methods.
+type Handler func(args []string) ([]string, error)
+
+type Option func(*Server)
+
+// WithPassword requires clients to authenticate with password before running
+// commands other than password, ping, close, commands and notcommands.
+func WithPassword(password string) Option {
+	return func(s *Server) {
+		s.password = password
+	}
+}
+
+// WithVersion sets the protocol version announced in the greeting.
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+// WithDatabase sets the songs of the database.
+func WithDatabase(songs ...Song) Option {
+	return func(s *Server) {
+		s.db = append(s.db, songs...)
+	}
+}
+
+// WithAlbumArt sets the cover file of the directory dir, which albumart
+// returns for the songs in it.
+func WithAlbumArt(dir string, data []byte) Option {
+	return func(s *Server) {
+		s.albumArt[strings.TrimSuffix(dir, "/")] = data
+	}
+}
+
+// WithPicture sets the picture embedded in the song file, which readpicture
+// returns.
+func WithPicture(file string, data []byte) Option {
+	return func(s *Server) {
+		s.pictures[file] = data
+	}
+}
+
+// WithUnixSocket listens on a unix socket at path instead of a TCP port on
+// the loopback interface.
+func WithUnixSocket(path string) Option {
+	return func(s *Server) {
+		s.network = "unix"
+		s.addr = path
+	}
+}
+
+// WithHandler scripts command, see Server.Handle.
+func WithHandler(command string, handler Handler) Option {
+	return func(s *Server) {
+		s.handlers[command] = handler
+	}
+}
+
+// Server is an in-process MPD server.
+type Server struct {
+	network  string
+	addr     string
+	version  string
+	password string
+	listener net.Listener
+
+	lock     deadlock.Mutex
+	handlers map[string]Handler
+	conns    map[*conn]struct{}
+	refuse   bool
+	received []string
+	player
+
+	// cover files by directory, and embedded pictures by song
+	albumArt map[string][]byte
+	pictures map[string][]byte
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewServer starts a server listening on a free loopback TCP port, or the
+// socket set with WithUnixSocket.
+func NewServer(options ...Option) (*Server, error) {
+	s := &Server{
+		network:  "tcp",
+		addr:     "127.0.0.1:0",
+		version:  DefaultVersion,
+		handlers: make(map[string]Handler),
+		conns:    make(map[*conn]struct{}),
+		player:   newPlayer(),
+		albumArt: make(map[string][]byte),
+		pictures: make(map[string][]byte),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	listener, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+	s.addr = listener.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Network returns the network to dial, "tcp" or "unix".
+func (s *Server) Network() string {
+	return s.network
+}
+
+// Addr returns the address to dial.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Close stops listening, disconnects all clients and waits for the
+// connection goroutines to finish.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.listener.Close()
+		s.DisconnectAll()
+		s.wg.Wait()
+	})
+	return err
+}
+
+// Handle scripts command, replacing the built-in implementation. A nil
+// handler restores it.
+func (s *Server) Handle(command string, handler Handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if handler == nil {
+		delete(s.handlers, command)
+	} else {
+		s.handlers[command] = handler
+	}
+}
+
+// DisconnectAll closes the connections of all clients.
+func (s *Server) DisconnectAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+}
+
+// SetAcceptConnections sets whether new connections are served. Refused
+// connections are closed before the greeting, so dialing clients fail.
+func (s *Server) SetAcceptConnections(accept bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.refuse = !accept
+}
+
+// Connections returns the number of connected clients.
+func (s *Server) Connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.conns)
+}
+
+// Received returns the command lines received from clients, in order.
+func (s *Server) Received() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.received...)
+}
+
+// Notify reports changes of subsystems to idling clients, or to their next idle.
+func (s *Server) Notify(subsystems ...mmpd.Subsystem) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.notify(subsystems...)
+}
+
+// Exec runs command line as an authenticated client and returns the
+// response lines.
+func (s *Server) Exec(line string) ([]string, error) {
+	name, args, err := splitCommand(line)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(&conn{server: s, authenticated: true}, name, args)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		if s.refuse {
+			s.lock.Unlock()
+			_ = nc.Close()
+			continue
+		}
+		c := &conn{
+			server:        s,
+			nc:            nc,
+			w:             bufio.NewWriter(nc),
+			authenticated: s.password == "",
+			pending:       make(map[mmpd.Subsystem]struct{}),
+			wake:          make(chan struct{}, 1),
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.lock.Unlock()
+
+		go c.serve()
+	}
+}
+
+// notify must be called with the lock held.
+func (s *Server) notify(subsystems ...mmpd.Subsystem) {
+	for c := range s.conns {
+		for _, subsystem := range subsystems {
+			c.pending[subsystem] = struct{}{}
+		}
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// unrestricted are the commands permitted before authentication.
+var unrestricted = map[string]bool{"password": true, "ping": true, "close": true, "commands": true, "notcommands": true}
+
+func (s *Server) run(c *conn, name string, args []string) ([]string, error) {
+	s.lock.Lock()
+	if !c.authenticated && !unrestricted[name] {
+		s.lock.Unlock()
+		return nil, ackError(mmpd.AckPermission, "you don't have permission for \"%s\"", name)
+	}
+	if handler, ok := s.handlers[name]; ok {
+		s.lock.Unlock()
+		return handler(args)
+	}
+	defer s.lock.Unlock()
+
+	if command, ok := commands[name]; ok {
+		return command(c, args)
+	}
+	return nil, ackError(mmpd.AckUnknown, "unknown command \"%s\"", name)
+}
+
+// commandNames returns the names of all commands, as listed by commands.
+//
+// Must be called with the lock held.
+func (s *Server) commandNames() []string {
+	names := []string{"close", "command_list_begin", "command_list_end", "command_list_ok_begin", "idle", "noidle"}
+	for name := range commands {
+		names = append(names, name)
+	}
+	for name := range s.handlers {
+		if _, ok := commands[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// conn is a client connection.
+type conn struct {
+	server        *Server
+	nc            net.Conn
+	w             *bufio.Writer
+	authenticated bool
+
+	// enabled tag types, nil if all are enabled
+	tagTypes map[string]bool
+
+	// the maximum size of binary chunks, set with binarylimit
+	binaryLimit int
+
+	// subsystems changed since the last idle, guarded by the server lock
+	pending map[mmpd.Subsystem]struct{}
+	wake    chan struct{}
+}
+
+func (c *conn) serve() {
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		_ = c.nc.Close()
+		c.server.lock.Lock()
+		delete(c.server.conns, c)
+		c.server.lock.Unlock()
+		c.server.wg.Done()
+	}()
+
+	c.writeLine("OK MPD " + c.server.version)
+	if c.w.Flush() != nil {
+		return
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		r := textproto.NewReader(bufio.NewReader(c.nc))
+		for {
+			line, err := r.ReadLine()
+			if err != nil {
+				return
+			}
+			select {
+			case lines <- line:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for line := range lines {
+		if !c.handle(line, lines) {
+			return
+		}
+		if c.w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// handle runs a line received from the client, and returns false if the
+// connection is to be closed.
+func (c *conn) handle(line string, lines <-chan string) bool {
+	name, args, err := splitCommand(line)
+	if err != nil {
+		c.writeAck(err, 0, "")
+		return true
+	}
+
+	c.record(line)
+
+	switch name {
+	case "close":
+		return false
+	case "idle":
+		return c.idle(args, lines)
+	case "noidle":
+		// ignored if not idling
+		return true
+	case "command_list_begin", "command_list_ok_begin":
+		return c.commandList(name == "command_list_ok_begin", lines)
+	}
+
+	response, err := c.server.run(c, name, args)
+	c.writeLines(response)
+	if err != nil {
+		c.writeAck(err, 0, name)
+		return true
+	}
+	c.writeLine("OK")
+	return true
+}
+
+func (c *conn) commandList(listOK bool, lines <-chan string) bool {
+	var list []string
+	for {
+		line, ok := <-lines
+		if !ok {
+			return false
+		} else if line == "command_list_end" {
+			break
+		}
+		list = append(list, line)
+	}
+
+	for idx, line := range list {
+		name, args, err := splitCommand(line)
+		if err == nil {
+			var response []string
+			response, err = c.server.run(c, name, args)
+			c.writeLines(response)
+			if err == nil {
+				if listOK {
+					c.writeLine("list_OK")
+				}
+				continue
+			}
+		}
+		c.writeAck(err, idx, name)
+		return true
+	}
+	c.writeLine("OK")
+	return true
+}
+
+// idle waits for changes of the subsystems in args, or of any if empty,
+// until noidle is received.
+func (c *conn) idle(args []string, lines <-chan string) bool {
+	for {
+		if changed := c.takePending(args); len(changed) > 0 {
+			for _, subsystem := range changed {
+				c.writeLine("changed: " + string(subsystem))
+			}
+			c.writeLine("OK")
+			return true
+		}
+
+		select {
+		case <-c.wake:
+		case line, ok := <-lines:
+			if !ok {
+				return false
+			}
+			c.record(line)
+			if line != "noidle" {
+				// like MPD, drop clients sending other commands while idling
+				return false
+			}
+			c.writeLine("OK")
+			return true
+		}
+	}
+}
+
+// record adds line to the lines received by the server.
+func (c *conn) record(line string) {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+
+	c.server.received = append(c.server.received, line)
+}
+
+func (c *conn) takePending(filter []string) []mmpd.Subsystem {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+
+	var changed []mmpd.Subsystem
+	for subsystem := range c.pending {
+		if len(filter) == 0 || contains(filter, string(subsystem)) {
+			changed = append(changed, subsystem)
+			delete(c.pending, subsystem)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	return changed
+}
+
+func (c *conn) writeLine(line string) {
+	_, _ = c.w.WriteString(line)
+	_ = c.w.WriteByte('\n')
+}
+
+func (c *conn) writeLines(lines []string) {
+	for _, line := range lines {
+		c.writeLine(line)
+	}
+}
+
+func (c *conn) writeAck(err error, listIdx int, command string) {
+	code := mmpd.AckSystem
+	message := err.Error()
+	var ackErr *mmpd.AckError
+	if errors.As(err, &ackErr) {
+		code, message = ackErr.Code, ackErr.Message
+	}
+	c.writeLine(fmt.Sprintf("ACK [%d@%d] {%s} %s", int(code), listIdx, command, message))
+}
+
+func ackError(code mmpd.AckCode, format string, args ...interface{}) error {
+	return &mmpd.AckError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// splitCommand splits a command line into the command name and its
+// arguments, which may be quoted with backslash escapes.
+func splitCommand(line string) (string, []string, error) {
+	var tokens []string
+	for i := 0; i < len(line); {
+		switch {
+		case line[i] == ' ' || line[i] == '\t':
+			i++
+		case line[i] == '"':
+			var token strings.Builder
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				token.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return "", nil, ackError(mmpd.AckArg, "Missing closing '\"'")
+			}
+			i++
+			tokens = append(tokens, token.String())
+		default:
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			tokens = append(tokens, line[start:i])
+		}
+	}
+	if len(tokens) == 0 {
+		return "", nil, ackError(mmpd.AckUnknown, "No command given")
+	}
+	return tokens[0], tokens[1:], nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package mpdtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fhs/gompd/v2/mpd"
+	"github.com/mkke/mmpd"
+)
+
+// nextEvent returns the next subsystem reported by w.
+func nextEvent(t *testing.T, w *mpd.Watcher) string {
+	t.Helper()
+
+	select {
+	case subsystem := <-w.Event:
+		return subsystem
+	case err := <-w.Error:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for idle")
+	}
+	return ""
+}
+
+func TestIdle(t *testing.T) {
+	srv, err := NewServer(WithDatabase(NewSong("a.flac", "Title", "A")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	w, err := mpd.NewWatcher(srv.Network(), srv.Addr(), "", "player")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := srv.Exec(`add "a.flac"`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Exec("play"); err != nil {
+		t.Fatal(err)
+	}
+	if subsystem := nextEvent(t, w); subsystem != "player" {
+		t.Errorf("got %s, want player", subsystem)
+	}
+
+	// changes of other subsystems are kept until an idle asks for them,
+	// which ends the running idle with noidle
+	if _, err := srv.Exec("setvol 30"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Notify(mmpd.SubsystemDatabase)
+	w.Subsystems("mixer", "database")
+	for _, want := range []string{"database", "mixer"} {
+		if subsystem := nextEvent(t, w); subsystem != want {
+			t.Errorf("got %s, want %s", subsystem, want)
+		}
+	}
+
+	received := srv.Received()
+	noidle := false
+	for _, line := range received {
+		noidle = noidle || line == "noidle"
+	}
+	if !noidle {
+		t.Errorf("no noidle in %q", received)
+	}
+}
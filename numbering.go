@@ -0,0 +1,128 @@
+package mmpd
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Numbering is a track, disc or movement number as found in tags, like "3",
+// "3/12", "A1" (side A of a record) or, for movements, "IV".
+type Numbering struct {
+	// the tag value as sent by MPD
+	Raw string
+
+	// a non-numeric prefix, e.g. the record side "A" of "A1"
+	Prefix string
+
+	// 0 if the value has no number
+	Number int
+
+	// the total, e.g. 12 of "3/12"; 0 if unknown
+	Total int
+}
+
+// ParseNumbering parses s leniently: anything that is not understood is
+// only kept in Raw.
+//
+// Roman numerals are not understood, as track and disc values like "D" or
+// "MIX" are more likely record sides and names; see ParseMovementNumbering.
+func ParseNumbering(s string) Numbering {
+	return parseNumbering(s, false)
+}
+
+// ParseMovementNumbering parses s like ParseNumbering, but also understands
+// Roman numerals like "IV", which are common for movements.
+func ParseMovementNumbering(s string) Numbering {
+	return parseNumbering(s, true)
+}
+
+func parseNumbering(s string, roman bool) Numbering {
+	n := Numbering{Raw: s}
+
+	value, total, _ := strings.Cut(strings.TrimSpace(s), "/")
+	n.Total, _ = strconv.Atoi(strings.TrimSpace(total))
+	value = strings.TrimSpace(value)
+
+	if roman {
+		if number := parseRoman(value); number > 0 {
+			n.Number = number
+			return n
+		}
+	}
+
+	// split off a prefix of letters, then take the leading digits
+	digits := strings.TrimLeftFunc(value, unicode.IsLetter)
+	prefix := strings.TrimSpace(value[:len(value)-len(digits)])
+	end := strings.IndexFunc(digits, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		end = len(digits)
+	}
+	if number, err := strconv.Atoi(digits[:end]); err == nil {
+		n.Prefix = prefix
+		n.Number = number
+	}
+	return n
+}
+
+func (n Numbering) String() string {
+	return n.Raw
+}
+
+// Compare orders numberings by Prefix, Number and Raw, so "A2" < "A10" < "B1".
+func (n Numbering) Compare(other Numbering) int {
+	if c := strings.Compare(strings.ToUpper(n.Prefix), strings.ToUpper(other.Prefix)); c != 0 {
+		return c
+	}
+	if n.Number != other.Number {
+		if n.Number < other.Number {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(n.Raw, other.Raw)
+}
+
+var romanValues = map[rune]int{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+
+// parseRoman returns the value of the roman numeral s, or 0 if it is none.
+func parseRoman(s string) int {
+	s = strings.ToUpper(s)
+	if s == "" {
+		return 0
+	}
+
+	total, last := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		value, ok := romanValues[rune(s[i])]
+		if !ok {
+			return 0
+		}
+		if value < last {
+			total -= value
+		} else {
+			total += value
+			last = value
+		}
+	}
+	if total <= 0 || toRoman(total) != s {
+		// not canonical, like "IIII" or a word made of numeral letters
+		return 0
+	}
+	return total
+}
+
+func toRoman(n int) string {
+	var b strings.Builder
+	for _, r := range []struct {
+		value   int
+		numeral string
+	}{{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"}} {
+		for n >= r.value {
+			b.WriteString(r.numeral)
+			n -= r.value
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package mmpd_test
+
+import (
+	"testing"
+
+	"github.com/fhs/gompd/v2/mpd"
+	"github.com/mkke/mmpd"
+)
+
+func TestParseNumbering(t *testing.T) {
+	tests := []struct {
+		s      string
+		prefix string
+		number int
+		total  int
+	}{
+		{"3", "", 3, 0},
+		{"3/12", "", 3, 12},
+		{" 03 / 12 ", "", 3, 12},
+		{"A1", "A", 1, 0},
+		{"B12/24", "B", 12, 24},
+		{"Intro", "", 0, 0},
+		{"", "", 0, 0},
+		// record sides and names made of numeral letters
+		{"D", "", 0, 0},
+		{"C", "", 0, 0},
+		{"MIX", "", 0, 0},
+		{"DC", "", 0, 0},
+		{"D2", "D", 2, 0},
+		{"IV", "", 0, 0},
+	}
+	for _, test := range tests {
+		n := mmpd.ParseNumbering(test.s)
+		if n.Raw != test.s || n.Prefix != test.prefix || n.Number != test.number || n.Total != test.total {
+			t.Errorf("%q parsed as %+v", test.s, n)
+		}
+	}
+}
+
+func TestParseMovementNumbering(t *testing.T) {
+	tests := []struct {
+		s      string
+		number int
+		total  int
+	}{
+		{"IV", 4, 0},
+		{"xii", 12, 0},
+		{"II/IV", 2, 0},
+		{"3/4", 3, 4},
+		{"MIX", 1009, 0},
+		{"IIII", 0, 0},
+		{"Finale", 0, 0},
+	}
+	for _, test := range tests {
+		n := mmpd.ParseMovementNumbering(test.s)
+		if n.Raw != test.s || n.Number != test.number || n.Total != test.total {
+			t.Errorf("%q parsed as %+v", test.s, n)
+		}
+	}
+
+	// only movement numbers are read as roman numerals
+	entry := mmpd.ParsePlaylistEntryAttrs(mpd.Attrs{"file": "a.flac", "Track": "D", "Disc": "C", "MovementNumber": "IV"})
+	if entry.TrackNumbering.Number != 0 || entry.DiscNumbering.Number != 0 || entry.MovementNumbering.Number != 4 {
+		t.Errorf("track %+v, disc %+v, movement %+v", entry.TrackNumbering, entry.DiscNumbering, entry.MovementNumbering)
+	}
+}
+
+func TestNumberingCompare(t *testing.T) {
+	ordered := []string{"1", "2", "10", "A1", "A2", "A10", "B1"}
+	for i := 1; i < len(ordered); i++ {
+		a, b := mmpd.ParseNumbering(ordered[i-1]), mmpd.ParseNumbering(ordered[i])
+		if a.Compare(b) >= 0 || b.Compare(a) <= 0 {
+			t.Errorf("%s not ordered before %s", a, b)
+		}
+	}
+}
@@ -1,15 +1,22 @@
 package mmpd
 
 import (
-	"reflect"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fhs/gompd/v2/mpd"
 )
 
 type Playlist struct {
-	Entries []*PlaylistEntry
+	Entries []*PlaylistEntry `json:"entries"`
+
+	// the playlist version (see Status.Playlist) the entries were loaded at
+	Version uint32 `json:"version"`
+
+	// set if the playlist contains local edits that MPD has not confirmed yet
+	Optimistic bool `json:"optimistic,omitempty"`
 }
 
 func NewPlaylist(attrsList []mpd.Attrs) *Playlist {
@@ -20,8 +27,69 @@ func NewPlaylist(attrsList []mpd.Attrs) *Playlist {
 	return &Playlist{Entries: entries}
 }
 
+// loadPlaylist fetches the playlist for status. If the cached playlist is
+// confirmed by MPD, only the changes since its version are fetched with
+// plchanges; otherwise, or if the server does not support it, the whole
+// playlist is fetched with playlistinfo.
+func loadPlaylist(client *ReconnectingClient, cached *Playlist, status *Status) (*Playlist, error) {
+	if cached != nil && !cached.Optimistic && client.ServerInfoCache.Load().CanRun("plchanges") {
+		attrsList, err := client.Command("plchanges %d", cached.Version).AttrsList("file")
+		if err == nil {
+			changed := NewPlaylist(attrsList).Entries
+			setRequestedTags(changed, client.requestedTags())
+			if playlist := cached.withChanges(changed, status.PlaylistLength); playlist != nil {
+				playlist.Version = status.Playlist
+				return playlist, nil
+			}
+			fmt.Printf("mpd: plchanges did not cover playlist #%d; reloading\n", status.Playlist)
+		} else if IsTransient(err) {
+			return nil, err
+		} else {
+			fmt.Printf("mpd: plchanges failed: %v; reloading\n", err)
+		}
+	}
+
+	attrsList, err := client.PlaylistInfo(-1, -1)
+	if err != nil {
+		return nil, err
+	}
+	playlist := NewPlaylist(attrsList)
+	playlist.Version = status.Playlist
+	setRequestedTags(playlist.Entries, client.requestedTags())
+	return playlist, nil
+}
+
+func setRequestedTags(entries []*PlaylistEntry, tags []Tag) {
+	for _, entry := range entries {
+		entry.RequestedTags = tags
+	}
+}
+
+// withChanges returns a copy of the playlist truncated to length, with the
+// changed entries replacing those at their position. nil is returned if
+// the changes leave positions without an entry.
+func (p *Playlist) withChanges(changed []*PlaylistEntry, length int) *Playlist {
+	entries := make([]*PlaylistEntry, length)
+	copy(entries, p.Entries)
+	for _, entry := range changed {
+		if entry.Pos < 0 || entry.Pos >= length {
+			return nil
+		}
+		entries[entry.Pos] = entry
+	}
+	for _, entry := range entries {
+		if entry == nil {
+			return nil
+		}
+	}
+	return &Playlist{Entries: entries}
+}
+
 // PlaylistEntry represents song attributes of a playlist entry.
 type PlaylistEntry struct {
+	// the song file URI, relative to the music directory.
+	File string
+
 	// the artist name. Its meaning is not well-defined; see “composer” and “performer” for more specific tags.
 	Artist string
 
@@ -46,9 +114,12 @@ type PlaylistEntry struct {
 	// same as title, but for sorting.
 	TitleSort string
 
-	// the decimal track number within the album.
+	// the decimal track number within the album; 0 if it has no number.
 	Track int
 
+	// the track number as sent, e.g. "3/12" or "A1"
+	TrackNumbering Numbering
+
 	// a name for this song. This is not the song title. The exact meaning of this tag is not well-defined. It is often used by badly configured internet radio stations with broken tags to squeeze both the artist name and the song title in one tag.
 	Name string
 
@@ -88,6 +159,9 @@ type PlaylistEntry struct {
 	// movement number, e.g. “2” or “II”.
 	MovementNumber string
 
+	// MovementNumber parsed, including roman numerals
+	MovementNumbering Numbering
+
 	// location of the recording, e.g. “Royal Albert Hall”.
 	Location string
 
@@ -97,9 +171,12 @@ type PlaylistEntry struct {
 	// a human-readable comment about this song. The exact meaning of this tag is not well-defined.
 	Comment string
 
-	// the decimal disc number in a multi-disc album.
+	// the decimal disc number in a multi-disc album; 0 if it has no number.
 	Disc int
 
+	// the disc number as sent, e.g. "1/2"
+	DiscNumbering Numbering
+
 	// the name of the label or publisher.
 	Label string
 
@@ -125,7 +202,7 @@ type PlaylistEntry struct {
 	MusicbrainzWorkId string
 
 	// the duration of the song in seconds; may contain a fractional part.
-	Duration float32
+	Duration float64
 
 	// like duration, but as integer value. This is deprecated and is only here for compatibility with older clients. Do not use.
 	Time int
@@ -133,23 +210,165 @@ type PlaylistEntry struct {
 	// if this is a queue item referring only to a portion of the song file, then this attribute contains the time range in the form START-END or START- (open ended); both START and END are time stamps within the song in seconds (may contain a fractional part). Example: 60-120 plays only the second minute; “180 skips the first three minutes.
 	Range string
 
+	// Range parsed; zero if Range is empty or invalid
+	SongRange SongRange
+
 	// the audio format of the song (or an approximation to a format supported by MPD and the decoder plugin being used). When playing this file, the audio value in the status response should be the same.
 	Format string
 
+	// Format parsed; zero if Format is empty or invalid
+	AudioFormat AudioFormat
+
 	// the time stamp of the last modification of the underlying file in ISO 8601 format. Example: “2008-09-28T20:04:57Z”
 	LastModified string
 
 	// the time stamp when the file was added in ISO 8601. A negative value means that this is unknown/unavailable. Example: “2023-11-25T13:25:07Z”
 	Added string
+
+	// the position of the queue item, starting at 0.
+	Pos int
+
+	// the song id of the queue item, which stays the same while the song is in the queue.
+	Id int
+
+	// the priority of the queue item for random playback, 0-255.
+	Prio int
+
+	// the tags the entry was requested with (see WithTagTypes), or nil if all
+	// tags were requested.
+	RequestedTags []Tag
+}
+
+// Length returns the duration of the song file.
+func (pe *PlaylistEntry) Length() time.Duration {
+	if pe.Duration > 0 {
+		return secondsToDuration(pe.Duration)
+	}
+	return time.Duration(pe.Time) * time.Second
+}
+
+// PlayableDuration returns the duration that is played of the entry, which is
+// shorter than Length if the entry has a SongRange. 0 is returned for an
+// open ended range of a song with unknown length.
+func (pe *PlaylistEntry) PlayableDuration() time.Duration {
+	if pe.SongRange.IsZero() {
+		return pe.Length()
+	}
+	return pe.SongRange.Duration(pe.Length())
 }
 
-func (pe *PlaylistEntry) Equals(other *PlaylistEntry) bool {
-	if pe == nil && other == nil {
+// LastModifiedTime returns LastModified, or the zero time if it is not set.
+func (pe *PlaylistEntry) LastModifiedTime() time.Time {
+	return parseTimestamp(pe.LastModified)
+}
+
+// AddedTime returns Added, or the zero time if it is not set or unknown.
+func (pe *PlaylistEntry) AddedTime() time.Time {
+	return parseTimestamp(pe.Added)
+}
+
+// IsTagRequested reports whether tag was requested for the entry. An empty
+// field of a requested tag means the song does not have the tag, while for
+// other tags it is unknown.
+func (pe *PlaylistEntry) IsTagRequested(tag Tag) bool {
+	if pe.RequestedTags == nil {
 		return true
-	} else if pe != nil && other != nil {
-		return reflect.DeepEqual(pe, other)
-	} else {
-		return false
+	}
+	for _, t := range pe.RequestedTags {
+		if strings.EqualFold(string(t), string(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// TagValue returns the value of tag, or an empty string if it is not set.
+func (pe *PlaylistEntry) TagValue(tag Tag) string {
+	switch strings.ToLower(string(tag)) {
+	case "file":
+		return pe.File
+	case "artist":
+		return pe.Artist
+	case "artistsort":
+		return pe.ArtistSort
+	case "album":
+		return pe.Album
+	case "albumsort":
+		return pe.AlbumSort
+	case "albumartist":
+		return pe.AlbumArtist
+	case "albumartistsort":
+		return pe.AlbumArtistSort
+	case "title":
+		return pe.Title
+	case "titlesort":
+		return pe.TitleSort
+	case "track":
+		if pe.TrackNumbering.Raw == "" && pe.Track != 0 {
+			return strconv.Itoa(pe.Track)
+		}
+		return pe.TrackNumbering.Raw
+	case "name":
+		return pe.Name
+	case "genre":
+		return pe.Genre
+	case "mood":
+		return pe.Mood
+	case "date":
+		return pe.Date
+	case "originaldate":
+		return pe.OriginalDate
+	case "composer":
+		return pe.Composer
+	case "composersort":
+		return pe.ComposerSort
+	case "performer":
+		return pe.Performer
+	case "conductor":
+		return pe.Conductor
+	case "work":
+		return pe.Work
+	case "ensemble":
+		return pe.Ensemble
+	case "movement":
+		return pe.Movement
+	case "movementnumber":
+		return pe.MovementNumber
+	case "location":
+		return pe.Location
+	case "grouping":
+		return pe.Grouping
+	case "comment":
+		return pe.Comment
+	case "disc":
+		if pe.DiscNumbering.Raw == "" && pe.Disc != 0 {
+			return strconv.Itoa(pe.Disc)
+		}
+		return pe.DiscNumbering.Raw
+	case "label":
+		return pe.Label
+	case "musicbrainz_artistid":
+		return pe.MusicbrainzArtistId
+	case "musicbrainz_albumid":
+		return pe.MusicbrainzAlbumId
+	case "musicbrainz_albumartistid":
+		return pe.MusicbrainzAlbumArtistId
+	case "musicbrainz_trackid":
+		return pe.MusicbrainzTrackId
+	case "musicbrainz_releasegroupid":
+		return pe.MusicbrainzReleaseGroupId
+	case "musicbrainz_releasetrackid":
+		return pe.MusicbrainzReleaseTrackId
+	case "musicbrainz_workid":
+		return pe.MusicbrainzWorkId
+	case "last-modified", "lastmodified":
+		return pe.LastModified
+	case "added":
+		return pe.Added
+	case "audioformat", "format":
+		return pe.Format
+	default:
+		return ""
 	}
 }
 
@@ -157,6 +376,8 @@ func ParsePlaylistEntryAttrs(attrs mpd.Attrs) *PlaylistEntry {
 	entry := &PlaylistEntry{}
 	for k, v := range attrs {
 		switch strings.ToLower(k) {
+		case "file":
+			entry.File = v
 		case "artist":
 			entry.Artist = v
 		case "artistsort":
@@ -174,7 +395,8 @@ func ParsePlaylistEntryAttrs(attrs mpd.Attrs) *PlaylistEntry {
 		case "titlesort":
 			entry.TitleSort = v
 		case "track":
-			entry.Track, _ = strconv.Atoi(v)
+			entry.TrackNumbering = ParseNumbering(v)
+			entry.Track = entry.TrackNumbering.Number
 		case "name":
 			entry.Name = v
 		case "genre":
@@ -201,6 +423,7 @@ func ParsePlaylistEntryAttrs(attrs mpd.Attrs) *PlaylistEntry {
 			entry.Movement = v
 		case "movementnumber":
 			entry.MovementNumber = v
+			entry.MovementNumbering = ParseMovementNumbering(v)
 		case "location":
 			entry.Location = v
 		case "grouping":
@@ -208,7 +431,8 @@ func ParsePlaylistEntryAttrs(attrs mpd.Attrs) *PlaylistEntry {
 		case "comment":
 			entry.Comment = v
 		case "disc":
-			entry.Disc, _ = strconv.Atoi(v)
+			entry.DiscNumbering = ParseNumbering(v)
+			entry.Disc = entry.DiscNumbering.Number
 		case "label":
 			entry.Label = v
 		case "musicbrainz_artistid":
@@ -226,19 +450,27 @@ func ParsePlaylistEntryAttrs(attrs mpd.Attrs) *PlaylistEntry {
 		case "musicbrainz_workid":
 			entry.MusicbrainzWorkId = v
 		case "duration":
-			if f, err := strconv.ParseFloat(v, 32); err == nil {
-				entry.Duration = float32(f)
+			if d, err := parseSeconds(v); err == nil {
+				entry.Duration = d.Seconds()
 			}
 		case "time":
 			entry.Time, _ = strconv.Atoi(v)
 		case "range":
 			entry.Range = v
+			entry.SongRange, _ = ParseSongRange(v)
 		case "format":
 			entry.Format = v
-		case "lastmodified":
+			entry.AudioFormat, _ = ParseAudioFormat(v)
+		case "lastmodified", "last-modified":
 			entry.LastModified = v
 		case "added":
 			entry.Added = v
+		case "pos":
+			entry.Pos, _ = strconv.Atoi(v)
+		case "id":
+			entry.Id, _ = strconv.Atoi(v)
+		case "prio":
+			entry.Prio, _ = strconv.Atoi(v)
 
 		}
 	}
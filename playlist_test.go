@@ -0,0 +1,84 @@
+package mmpd_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mkke/mmpd"
+)
+
+// checkPlaylistCache fails the test unless the cached playlist matches the
+// queue of srv.
+func checkPlaylistCache(t *testing.T, client *mmpd.ReconnectingClient, files []string) {
+	t.Helper()
+
+	playlist := client.PlaylistCache.Load()
+	if playlist == nil || len(playlist.Entries) != len(files) {
+		t.Fatalf("cached playlist %+v, want %v", playlist, files)
+	}
+	for pos, entry := range playlist.Entries {
+		if entry.File != files[pos] || entry.Pos != pos {
+			t.Errorf("entry %d is %s at %d, want %s", pos, entry.File, entry.Pos, files[pos])
+		}
+	}
+	if status := client.StatusCache.Load(); playlist.Version != status.Playlist {
+		t.Errorf("playlist version %d, status %d", playlist.Version, status.Playlist)
+	}
+}
+
+func TestRefreshCachePlChanges(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a"`)
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	checkPlaylistCache(t, client, serverQueue(t, srv))
+
+	for _, edit := range []string{`add "b"`, `delete 0`, `move 0 2`, `clear`, `add "a/2.flac"`} {
+		exec(t, srv, edit)
+		if err := client.ReloadStatus(); err != nil {
+			t.Fatal(err)
+		}
+		checkPlaylistCache(t, client, serverQueue(t, srv))
+	}
+
+	plchanges := 0
+	for _, line := range srv.Received() {
+		if strings.HasPrefix(line, "plchanges ") {
+			plchanges++
+		}
+	}
+	if plchanges != 5 {
+		t.Errorf("%d plchanges for 5 edits", plchanges)
+	}
+}
+
+func TestRefreshCacheConcurrent(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a"`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Do(mmpd.RefreshCache); err != nil {
+				t.Error(err)
+			}
+		}()
+		if i%3 == 0 {
+			exec(t, srv, `add "b"`)
+		} else if i%3 == 1 {
+			exec(t, srv, `delete 0`)
+		}
+	}
+	wg.Wait()
+
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	checkPlaylistCache(t, client, serverQueue(t, srv))
+}
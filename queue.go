@@ -0,0 +1,331 @@
+package mmpd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+type QueueOption func(*Queue)
+
+// WithOptimisticUpdates applies queue edits to PlaylistCache right away,
+// before MPD has confirmed them.
+//
+// PlaylistChangedListeners are notified immediately with the edited playlist,
+// and again with the playlist reported by MPD once the edit is done. Edits
+// that fail are rolled back. Edits whose outcome depends on state the cache
+// does not know, like positions relative to the current song, are only
+// applied once MPD reports them.
+func WithOptimisticUpdates(optimistic bool) QueueOption {
+	return func(q *Queue) {
+		q.optimistic = optimistic
+	}
+}
+
+// Queue edits the queue (the current playlist) of a ReconnectingClient.
+//
+// All edits run via Do(), and edits of several songs are sent as a single
+// command list.
+type Queue struct {
+	client     *ReconnectingClient
+	optimistic bool
+}
+
+func NewQueue(client *ReconnectingClient, options ...QueueOption) *Queue {
+	q := &Queue{client: client}
+	for _, option := range options {
+		option(q)
+	}
+	return q
+}
+
+// Add appends the songs or directories uris to the queue.
+func (q *Queue) Add(uris ...string) error {
+	commands := make([]string, len(uris))
+	for idx, uri := range uris {
+		commands[idx] = "add " + quote(uri)
+	}
+	return q.edit(commands, nil)
+}
+
+// AddID adds the song uri at position pos, or at the end if pos is negative,
+// and returns its song id.
+//
+// Relative positions are not supported here; see FindAdd for those.
+func (q *Queue) AddID(uri string, pos int) (int, error) {
+	var id int
+	err := q.client.Do(func(client *ReconnectingClient) error {
+		var err error
+		id, err = client.AddID(uri, pos)
+		return err
+	})
+	q.reload()
+	return id, err
+}
+
+// DeleteID removes the songs with the given ids.
+func (q *Queue) DeleteID(ids ...int) error {
+	commands := make([]string, len(ids))
+	for idx, id := range ids {
+		commands[idx] = "deleteid " + strconv.Itoa(id)
+	}
+	return q.edit(commands, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		for _, id := range ids {
+			if pos := indexOfId(entries, id); pos >= 0 {
+				entries = append(entries[:pos], entries[pos+1:]...)
+			}
+		}
+		return entries
+	})
+}
+
+// Delete removes the songs at positions [start, end), or from start to the
+// end of the queue if end is negative.
+func (q *Queue) Delete(start, end int) error {
+	return q.edit([]string{"delete " + formatRange(start, end)}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		start, end := clampRange(start, end, len(entries))
+		return append(entries[:start], entries[end:]...)
+	})
+}
+
+// Move moves the songs at positions [start, end), or from start to the end
+// of the queue if end is negative, to position to. A negative to is
+// relative to the current song.
+func (q *Queue) Move(start, end, to int) error {
+	return q.edit([]string{fmt.Sprintf("move %s %d", formatRange(start, end), to)}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		start, end := clampRange(start, end, len(entries))
+		rest := len(entries) - (end - start)
+		if to < 0 || to > rest {
+			return nil
+		}
+		moved := append([]*PlaylistEntry(nil), entries[start:end]...)
+		entries = append(entries[:start], entries[end:]...)
+		return append(entries[:to], append(moved, entries[to:]...)...)
+	})
+}
+
+// MoveID moves the song with the given id to position to. A negative to is
+// relative to the current song.
+func (q *Queue) MoveID(id, to int) error {
+	return q.edit([]string{fmt.Sprintf("moveid %d %d", id, to)}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		pos := indexOfId(entries, id)
+		if pos < 0 || to < 0 || to >= len(entries) {
+			return nil
+		}
+		entry := entries[pos]
+		entries = append(entries[:pos], entries[pos+1:]...)
+		return append(entries[:to], append([]*PlaylistEntry{entry}, entries[to:]...)...)
+	})
+}
+
+// Swap swaps the songs at positions pos1 and pos2.
+func (q *Queue) Swap(pos1, pos2 int) error {
+	return q.edit([]string{fmt.Sprintf("swap %d %d", pos1, pos2)}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		if pos1 < 0 || pos1 >= len(entries) || pos2 < 0 || pos2 >= len(entries) {
+			return nil
+		}
+		entries[pos1], entries[pos2] = entries[pos2], entries[pos1]
+		return entries
+	})
+}
+
+// SwapID swaps the songs with the given ids.
+func (q *Queue) SwapID(id1, id2 int) error {
+	return q.edit([]string{fmt.Sprintf("swapid %d %d", id1, id2)}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		pos1, pos2 := indexOfId(entries, id1), indexOfId(entries, id2)
+		if pos1 >= 0 && pos2 >= 0 {
+			entries[pos1], entries[pos2] = entries[pos2], entries[pos1]
+		}
+		return entries
+	})
+}
+
+// Shuffle shuffles the songs at positions [start, end), or from start to
+// the end of the queue if end is negative, or the whole queue if start is
+// negative.
+//
+// The order MPD picks is not known in advance, so shuffling is never applied optimistically.
+func (q *Queue) Shuffle(start, end int) error {
+	if start < 0 {
+		return q.edit([]string{"shuffle"}, nil)
+	}
+	return q.edit([]string{"shuffle " + formatRange(start, end)}, nil)
+}
+
+// Clear removes all songs from the queue.
+func (q *Queue) Clear() error {
+	return q.edit([]string{"clear"}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		return entries[:0]
+	})
+}
+
+// SetPriority sets the priority of the songs at positions [start, end), or
+// from start to the end of the queue if end is negative.
+func (q *Queue) SetPriority(prio, start, end int) error {
+	return q.edit([]string{fmt.Sprintf("prio %d %s", prio, formatRange(start, end))}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		start, end := clampRange(start, end, len(entries))
+		for pos := start; pos < end; pos++ {
+			entries[pos] = withPrio(entries[pos], prio)
+		}
+		return entries
+	})
+}
+
+// SetPriorityID sets the priority of the songs with the given ids.
+func (q *Queue) SetPriorityID(prio int, ids ...int) error {
+	commands := make([]string, len(ids))
+	for idx, id := range ids {
+		commands[idx] = fmt.Sprintf("prioid %d %d", prio, id)
+	}
+	return q.edit(commands, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		for _, id := range ids {
+			if pos := indexOfId(entries, id); pos >= 0 {
+				entries[pos] = withPrio(entries[pos], prio)
+			}
+		}
+		return entries
+	})
+}
+
+// SetRangeID plays only the part [start, end) of the song with the given id,
+// in seconds. A negative start or end leaves that side open; both negative
+// removes the range.
+func (q *Queue) SetRangeID(id int, start, end float64) error {
+	var startStr, endStr string
+	if start >= 0 {
+		startStr = strconv.FormatFloat(start, 'f', 3, 64)
+	}
+	if end >= 0 {
+		endStr = strconv.FormatFloat(end, 'f', 3, 64)
+	}
+	return q.edit([]string{fmt.Sprintf("rangeid %d %s:%s", id, startStr, endStr)}, func(entries []*PlaylistEntry) []*PlaylistEntry {
+		if pos := indexOfId(entries, id); pos >= 0 {
+			entry := *entries[pos]
+			// the format playlistinfo reports ranges in, which always has a start
+			entry.Range = ""
+			if start >= 0 || end >= 0 {
+				entry.Range = strconv.FormatFloat(max(start, 0), 'f', 3, 64) + "-" + endStr
+			}
+			entry.SongRange, _ = ParseSongRange(entry.Range)
+			entries[pos] = &entry
+		}
+		return entries
+	})
+}
+
+// edit runs commands as a command list and, if optimistic updates are
+// enabled, applies apply to a copy of the cached playlist. apply returns
+// nil if it cannot predict the outcome of the commands.
+func (q *Queue) edit(commands []string, apply func(entries []*PlaylistEntry) []*PlaylistEntry) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	var oldPlaylist, optimistic *Playlist
+	if q.optimistic && apply != nil {
+		if oldPlaylist = q.client.PlaylistCache.Load(); oldPlaylist != nil {
+			if entries := apply(append([]*PlaylistEntry(nil), oldPlaylist.Entries...)); entries != nil {
+				optimistic = &Playlist{Entries: renumber(entries), Version: oldPlaylist.Version, Optimistic: true}
+				if !q.swapPlaylist(oldPlaylist, optimistic) {
+					optimistic = nil
+				}
+			}
+		}
+	}
+
+	err := q.client.Do(func(client *ReconnectingClient) error {
+		return RunCommandList(client, commands...)
+	})
+	// a playlist refreshed in the meantime is newer than both
+	if err != nil && optimistic != nil && q.swapPlaylist(optimistic, oldPlaylist) {
+		fmt.Printf("mpd: queue edit failed: %v; rolled back optimistic update\n", err)
+	}
+
+	q.reload()
+	return err
+}
+
+// swapPlaylist replaces the cached playlist by playlist if it is still old.
+func (q *Queue) swapPlaylist(old, playlist *Playlist) bool {
+	if !q.client.PlaylistCache.CompareAndSwap(old, playlist) {
+		return false
+	}
+	q.client.PlaylistChangedListeners.Notify(func(l *PlaylistChangedListener) {
+		l.PlaylistChanged(q.client, playlist)
+	})
+	return true
+}
+
+// reload fetches the new playlist version in the background, instead of
+// waiting for the next keepalive.
+func (q *Queue) reload() {
+	go func() {
+		if err := q.client.Do(RefreshCache); err != nil {
+			fmt.Printf("mpd: reloading status after queue edit failed: %v\n", err)
+		}
+	}()
+}
+
+// RunCommandList runs commands in a single command list. Arguments in
+// commands must already be quoted.
+//
+// Like all commands, it must be called via Do().
+func RunCommandList(client *ReconnectingClient, commands ...string) error {
+	if len(commands) == 1 {
+		return client.Command("%s", mpd.Quoted(commands[0])).OK()
+	}
+	list := "command_list_begin\n" + strings.Join(commands, "\n") + "\ncommand_list_end"
+	return client.Command("%s", mpd.Quoted(list)).OK()
+}
+
+func indexOfId(entries []*PlaylistEntry, id int) int {
+	for pos, entry := range entries {
+		if entry.Id == id {
+			return pos
+		}
+	}
+	return -1
+}
+
+// formatRange formats the positions [start, end) as MPD range argument,
+// which is open ended if end is negative.
+func formatRange(start, end int) string {
+	if end < 0 {
+		return strconv.Itoa(start) + ":"
+	}
+	return fmt.Sprintf("%d:%d", start, end)
+}
+
+func clampRange(start, end, length int) (int, int) {
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > length {
+		end = length
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
+}
+
+func withPrio(entry *PlaylistEntry, prio int) *PlaylistEntry {
+	updated := *entry
+	updated.Prio = prio
+	return &updated
+}
+
+// renumber updates the Pos of entries, copying those that moved so the
+// entries of the previous playlist stay untouched.
+func renumber(entries []*PlaylistEntry) []*PlaylistEntry {
+	for pos, entry := range entries {
+		if entry.Pos != pos {
+			updated := *entry
+			updated.Pos = pos
+			entries[pos] = &updated
+		}
+	}
+	return entries
+}
@@ -0,0 +1,205 @@
+package mmpd_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+)
+
+func TestQueueOpenEndedRanges(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a"`, `add "b"`)
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	q := mmpd.NewQueue(client, mmpd.WithOptimisticUpdates(true))
+
+	if err := q.SetPriority(10, 2, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Move(2, -1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := serverQueue(t, srv); len(got) != 4 || got[0] != "a/3.flac" || got[1] != "b/1.flac" {
+		t.Errorf("queue after move: %v", got)
+	}
+	if err := q.Shuffle(1, -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := serverQueue(t, srv); len(got) != 4 || got[0] != "a/3.flac" {
+		t.Errorf("queue after shuffle: %v", got)
+	}
+
+	if err := q.Delete(1, -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := serverQueue(t, srv); len(got) != 1 || got[0] != "a/3.flac" {
+		t.Errorf("queue after delete: %v", got)
+	}
+	eventually(t, "confirmed playlist", func() bool {
+		playlist := client.PlaylistCache.Load()
+		return !playlist.Optimistic && len(playlist.Entries) == 1 && playlist.Entries[0].Prio == 10
+	})
+}
+
+func TestQueueSetRangeIDOptimistic(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a/1.flac"`)
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	id := client.PlaylistCache.Load().Entries[0].Id
+
+	playlists := make(chan *mmpd.Playlist, 10)
+	client.PlaylistChangedListeners.Add(mmpd.NewPlaylistChangedListener(func(_ *mmpd.ReconnectingClient, playlist *mmpd.Playlist) {
+		playlists <- playlist
+	}))
+
+	for _, r := range [][2]float64{{-1, 60}, {30.5, -1}, {10, 20}} {
+		if err := mmpd.NewQueue(client, mmpd.WithOptimisticUpdates(true)).SetRangeID(id, r[0], r[1]); err != nil {
+			t.Fatal(err)
+		}
+		optimistic := receive(t, playlists)
+		confirmed := receive(t, playlists)
+		if !optimistic.Optimistic || confirmed.Optimistic {
+			t.Fatalf("unexpected playlist sequence")
+		}
+		o, c := optimistic.Entries[0], confirmed.Entries[0]
+		if o.Range != c.Range || o.SongRange != c.SongRange {
+			t.Errorf("optimistic range %q %v, confirmed %q %v", o.Range, o.SongRange, c.Range, c.SongRange)
+		}
+		if r[1] > 0 && c.PlayableDuration() != time.Duration((r[1]-max(r[0], 0))*float64(time.Second)) {
+			t.Errorf("playable duration %s", c.PlayableDuration())
+		}
+	}
+}
+
+func TestFindAddPosition(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a/1.flac"`, `add "a/2.flac"`)
+
+	err := client.Do(func(client *mmpd.ReconnectingClient) error {
+		return mmpd.FindAdd(client, mmpd.TagEquals(mmpd.TagArtist, "B"), mmpd.WithPosition("1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serverQueue(t, srv); len(got) != 3 || got[1] != "b/1.flac" {
+		t.Errorf("queue after findadd: %v", got)
+	}
+
+	err = client.Do(func(client *mmpd.ReconnectingClient) error {
+		return mmpd.FindAdd(client, mmpd.TagEquals(mmpd.TagArtist, "B"), mmpd.WithPosition("0\nclear"))
+	})
+	if !errors.Is(err, mmpd.ErrInvalidPosition) {
+		t.Errorf("got %v, want ErrInvalidPosition", err)
+	}
+	if got := serverQueue(t, srv); len(got) != 3 {
+		t.Errorf("queue after invalid findadd: %v", got)
+	}
+}
+
+func TestQueueOptimisticBounds(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a"`)
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	playlist := client.PlaylistCache.Load()
+	id := playlist.Entries[0].Id
+
+	playlists := make(chan *mmpd.Playlist, 10)
+	client.PlaylistChangedListeners.Add(mmpd.NewPlaylistChangedListener(func(_ *mmpd.ReconnectingClient, playlist *mmpd.Playlist) {
+		playlists <- playlist
+	}))
+	q := mmpd.NewQueue(client, mmpd.WithOptimisticUpdates(true))
+
+	// negative positions are relative to the current song, which the fake
+	// server does not support, and the others are out of range
+	for name, edit := range map[string]func() error{
+		"move to -1":      func() error { return q.Move(0, 1, -1) },
+		"move to 3":       func() error { return q.Move(0, 1, 3) },
+		"move range to 2": func() error { return q.Move(0, 2, 2) },
+		"moveid to -1":    func() error { return q.MoveID(id, -1) },
+		"moveid to 3":     func() error { return q.MoveID(id, 3) },
+		"swap -1 and 0":   func() error { return q.Swap(-1, 0) },
+		"swap 0 and 3":    func() error { return q.Swap(0, 3) },
+		"swap 3 and -1":   func() error { return q.Swap(3, -1) },
+	} {
+		if err := edit(); err == nil {
+			t.Errorf("%s succeeded", name)
+		}
+		select {
+		case playlist := <-playlists:
+			t.Errorf("%s: playlist %+v", name, playlist)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if client.PlaylistCache.Load() != playlist {
+			t.Errorf("%s changed the cached playlist", name)
+		}
+	}
+
+	// moving relative to the current song is only seen once MPD reports it
+	srv.Handle("moveid", func(args []string) ([]string, error) {
+		srv.Handle("moveid", nil)
+		return srv.Exec("moveid " + args[0] + " 2")
+	})
+	if err := q.MoveID(id, -1); err != nil {
+		t.Fatal(err)
+	}
+	if playlist := receive(t, playlists); playlist.Optimistic || playlist.Entries[2].Id != id {
+		t.Errorf("playlist after relative move %+v", playlist)
+	}
+}
+
+func TestQueueRollback(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	exec(t, srv, `add "a"`)
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	playlist := client.PlaylistCache.Load()
+
+	playlists := make(chan *mmpd.Playlist, 10)
+	client.PlaylistChangedListeners.Add(mmpd.NewPlaylistChangedListener(func(_ *mmpd.ReconnectingClient, playlist *mmpd.Playlist) {
+		playlists <- playlist
+	}))
+	q := mmpd.NewQueue(client, mmpd.WithOptimisticUpdates(true))
+
+	srv.Handle("swap", func([]string) ([]string, error) {
+		return nil, &mmpd.AckError{Code: mmpd.AckSystem, Message: "failed"}
+	})
+	if err := q.Swap(0, 1); err == nil {
+		t.Fatal("swap succeeded")
+	}
+	if optimistic := receive(t, playlists); !optimistic.Optimistic || optimistic.Entries[0].Id != playlist.Entries[1].Id {
+		t.Errorf("optimistic playlist %+v", optimistic)
+	}
+	if rolledBack := receive(t, playlists); rolledBack != playlist {
+		t.Errorf("rolled back to %+v", rolledBack)
+	}
+
+	// a playlist refreshed while the edit runs is not rolled back
+	newer := &mmpd.Playlist{Version: playlist.Version + 1}
+	srv.Handle("swap", func([]string) ([]string, error) {
+		client.PlaylistCache.Store(newer)
+		return nil, &mmpd.AckError{Code: mmpd.AckSystem, Message: "failed"}
+	})
+	if err := q.Swap(0, 1); err == nil {
+		t.Fatal("swap succeeded")
+	}
+	if optimistic := receive(t, playlists); !optimistic.Optimistic {
+		t.Errorf("optimistic playlist %+v", optimistic)
+	}
+	// the reload replaces the unknown version by the playlist of MPD
+	if reloaded := receive(t, playlists); reloaded == playlist || reloaded.Optimistic || len(reloaded.Entries) != 3 {
+		t.Errorf("rolled back to %+v", reloaded)
+	}
+}
@@ -0,0 +1,162 @@
+package mmpd
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+// rawConn is a minimal MPD protocol connection giving access to the raw
+// key/value pairs of a response.
+//
+// mpd.Client only returns fully parsed responses, which rules out streaming
+// large listings and responses with repeated keys like grouped list results.
+type rawConn struct {
+	text    *textproto.Conn
+	version string
+}
+
+func dialRaw(network, addr, password string) (*rawConn, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newRawConn(conn, password)
+}
+
+// newRawConn reads the greeting of conn and authenticates with password if
+// it is not empty. conn is closed if that fails.
+func newRawConn(conn net.Conn, password string) (*rawConn, error) {
+	text := textproto.NewConn(conn)
+	line, err := text.ReadLine()
+	if err != nil {
+		_ = text.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "OK MPD ") {
+		_ = text.Close()
+		return nil, textproto.ProtocolError("no greeting")
+	}
+
+	rc := &rawConn{text: text, version: line[7:]}
+	if password != "" {
+		if err := rc.command("password %s", password); err != nil {
+			_ = rc.close()
+			return nil, err
+		}
+		if err := rc.readOK(); err != nil {
+			_ = rc.close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// command sends a command. Like mpd.Client.Command, string args are quoted
+// unless passed as mpd.Quoted.
+func (rc *rawConn) command(format string, args ...interface{}) error {
+	for i := range args {
+		switch s := args[i].(type) {
+		case mpd.Quoted: // ignore
+		case string:
+			args[i] = quote(s)
+		}
+	}
+	if _, err := fmt.Fprintf(rc.text.W, format, args...); err != nil {
+		return err
+	}
+	if err := rc.text.W.WriteByte('\n'); err != nil {
+		return err
+	}
+	return rc.text.W.Flush()
+}
+
+// readLine reads the next response line, returning ACK lines as *AckError.
+func (rc *rawConn) readLine() (string, error) {
+	line, err := rc.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(line, "ACK ") {
+		return "", parseAck(line)
+	}
+	return line, nil
+}
+
+// readPair reads the next key/value pair of a response. ok is set when the
+// terminating OK has been read.
+func (rc *rawConn) readPair() (key, value string, ok bool, err error) {
+	line, err := rc.readLine()
+	if err != nil {
+		return "", "", false, err
+	}
+	if line == "OK" {
+		return "", "", true, nil
+	}
+	key, value, err = splitPair(line)
+	return key, value, false, err
+}
+
+func splitPair(line string) (key, value string, err error) {
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		return "", "", textproto.ProtocolError("can't parse line: " + line)
+	}
+	return line[:i], line[i+2:], nil
+}
+
+func (rc *rawConn) readOK() error {
+	for {
+		if _, _, ok, err := rc.readPair(); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+	}
+}
+
+func (rc *rawConn) close() error {
+	_, _ = fmt.Fprintf(rc.text.W, "close\n")
+	_ = rc.text.W.Flush()
+	return rc.text.Close()
+}
+
+// parseAck parses an error line of the form
+// "ACK [error@command_listNum] {current_command} message_text".
+func parseAck(line string) error {
+	cur := strings.TrimPrefix(line, "ACK ")
+	var code, idx int
+	if strings.HasPrefix(cur, "[") {
+		sep := strings.Index(cur, "@")
+		end := strings.Index(cur, "] ")
+		if sep > 0 && end > sep {
+			code, _ = strconv.Atoi(cur[1:sep])
+			idx, _ = strconv.Atoi(cur[sep+1 : end])
+			cur = cur[end+2:]
+		}
+	}
+	var cmd string
+	if strings.HasPrefix(cur, "{") {
+		if end := strings.Index(cur, "} "); end > 0 {
+			cmd = cur[1:end]
+			cur = cur[end+2:]
+		}
+	}
+	return &AckError{
+		Code:             AckCode(code),
+		CommandListIndex: idx,
+		Command:          cmd,
+		Message:          strings.TrimSpace(cur),
+	}
+}
+
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(2 + len(s))
+	appendQuoted(&b, s)
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package mmpd_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+func TestReconnectDoesNotBlockCommands(t *testing.T) {
+	srv := startServer(t)
+	dialer := mpdtest.NewDialer()
+	client := connect(t, srv, mmpd.WithDialer(dialer))
+
+	dialer.Hang()
+	dialer.Sever()
+	if err := client.Do(mmpd.Ping); !mmpd.IsTransient(err) {
+		t.Fatalf("ping on severed connection: %v", err)
+	}
+	eventually(t, "reconnect dial", func() bool { return dialer.Dials() == 2 })
+
+	// the reconnect hangs in the dial, which must not block commands
+	start := time.Now()
+	if err := client.Do(mmpd.Ping); !errors.Is(err, mmpd.ErrNotConnected) {
+		t.Errorf("ping while reconnecting: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ping while reconnecting took %s", d)
+	}
+
+	dialer.Release()
+	eventually(t, "reconnect", client.IsConnected)
+	if err := client.Do(mmpd.Ping); err != nil {
+		t.Errorf("ping after reconnect: %v", err)
+	}
+}
+
+func TestReconnectRetries(t *testing.T) {
+	srv := startServer(t)
+	dialer := mpdtest.NewDialer()
+	clock := mpdtest.NewClock(time.Now())
+	client := connect(t, srv, mmpd.WithDialer(dialer), mmpd.WithClock(clock))
+
+	dialer.SetFailure(errors.New("refused"))
+	dialer.Sever()
+	_ = client.Do(mmpd.Ping)
+
+	// an outage of a few minutes
+	for i := 0; i < 300; i++ {
+		clock.BlockUntil(1)
+		if err := client.Do(mmpd.Ping); !errors.Is(err, mmpd.ErrNotConnected) {
+			t.Fatalf("ping while reconnecting: %v", err)
+		}
+		clock.Advance(time.Second)
+	}
+
+	dialer.SetFailure(nil)
+	clock.Advance(time.Second)
+	eventually(t, "reconnect", client.IsConnected)
+	if dialer.Dials() < 300 {
+		t.Errorf("only %d dials", dialer.Dials())
+	}
+}
+
+func TestCloseDuringReconnect(t *testing.T) {
+	srv := startServer(t)
+	dialer := mpdtest.NewDialer()
+	t.Cleanup(dialer.Release)
+	client := connect(t, srv, mmpd.WithDialer(dialer))
+
+	dialer.Hang()
+	dialer.Sever()
+	_ = client.Do(mmpd.Ping)
+	eventually(t, "reconnect dial", func() bool { return dialer.Dials() == 2 })
+
+	closed := make(chan error)
+	go func() { closed <- client.Close() }()
+	if err := receive(t, closed); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	select {
+	case <-client.Done():
+	default:
+		t.Error("Done not closed")
+	}
+
+	// the hanging dial completes after the close, and must not reconnect
+	dialer.Release()
+	time.Sleep(50 * time.Millisecond)
+	if client.IsConnected() || dialer.Conns() != 0 {
+		t.Errorf("connected after close")
+	}
+	if err := client.Connect(); !errors.Is(err, mmpd.ErrClosed) {
+		t.Errorf("connect after close: %v", err)
+	}
+}
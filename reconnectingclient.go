@@ -4,40 +4,64 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/fhs/gompd/v2/mpd"
-	"github.com/go-test/deep"
 	"github.com/linkdata/deadlock"
 )
 
-var ErrNotConnected = errors.New("not connected")
+var (
+	ErrNotConnected = errors.New("not connected")
+	ErrClosed       = errors.New("client closed")
+)
 
 type ReconnectingClient struct {
 	*mpd.Client
-	network                     string
-	addr                        string
-	password                    string
-	keepalive                   bool
-	pingFunc                    PingFunc
-	blocking                    bool
-	watchSubsystems             []Subsystem
-	connectLock                 deadlock.RWMutex
-	idleStateLock               deadlock.Mutex
-	activeCommands              int
-	isConnected                 atomic.Bool
-	closeCh                     chan struct{}
-	keepaliveTicker             *time.Ticker
-	PlaylistCache               atomic.Pointer[Playlist]
-	StatusCache                 atomic.Pointer[Status]
-	CurrentSongCache            atomic.Pointer[CurrentSong]
-	ConnectedListeners          *ListenerSet[*ConnectedListener]
-	DisconnectedListeners       *ListenerSet[*DisconnectedListener]
-	SubsystemsChangedListeners  *ListenerSet[*SubsystemsChangedListener]
-	StatusChangedListeners      *ListenerSet[*StatusChangedListener]
-	PlaylistChangedListeners    *ListenerSet[*PlaylistChangedListener]
-	CurrentSongChangedListeners *ListenerSet[*CurrentSongChangedListener]
+	network                      string
+	addr                         string
+	password                     string
+	passwordProvider             PasswordProvider
+	credentialsLock              deadlock.Mutex
+	commands                     atomic.Pointer[CommandSet]
+	deniedCommands               atomic.Pointer[CommandSet]
+	reauthLock                   deadlock.Mutex
+	refreshLock                  deadlock.Mutex
+	reauthentications            atomic.Uint64
+	keepalive                    bool
+	pingFunc                     PingFunc
+	blocking                     bool
+	watchSubsystems              []Subsystem
+	tagTypes                     []Tag
+	tagTypesActive               atomic.Bool
+	recorder                     *Recorder
+	dialer                       Dialer
+	clock                        Clock
+	bridge                       *bridge
+	retryTimeout                 time.Duration
+	connectLock                  deadlock.RWMutex
+	idleStateLock                deadlock.Mutex
+	activeCommands               int
+	isConnected                  atomic.Bool
+	reconnecting                 atomic.Bool
+	done                         chan struct{}
+	closeOnce                    sync.Once
+	closeErr                     error
+	keepaliveStop                chan struct{}
+	keepaliveTicker              Ticker
+	PlaylistCache                atomic.Pointer[Playlist]
+	StatusCache                  atomic.Pointer[Status]
+	CurrentSongCache             atomic.Pointer[CurrentSong]
+	ServerInfoCache              atomic.Pointer[ServerInfo]
+	ConnectedListeners           *ListenerSet[*ConnectedListener]
+	DisconnectedListeners        *ListenerSet[*DisconnectedListener]
+	SubsystemsChangedListeners   *ListenerSet[*SubsystemsChangedListener]
+	StatusChangedListeners       *ListenerSet[*StatusChangedListener]
+	StatusFieldsChangedListeners *ListenerSet[*StatusFieldsChangedListener]
+	PlaylistChangedListeners     *ListenerSet[*PlaylistChangedListener]
+	CurrentSongChangedListeners  *ListenerSet[*CurrentSongChangedListener]
+	ServerInfoChangedListeners   *ListenerSet[*ServerInfoChangedListener]
 }
 
 type ClientOption func(*ReconnectingClient)
@@ -74,6 +98,26 @@ func WithPingFunc(pingFunc PingFunc) ClientOption {
 	}
 }
 
+// WithRetryTimeout sets how long DoIdempotent waits for a reconnect before
+// giving up on a command.
+func WithRetryTimeout(timeout time.Duration) ClientOption {
+	return func(client *ReconnectingClient) {
+		client.retryTimeout = timeout
+	}
+}
+
+// WithTagTypes restricts the tags MPD sends for songs to tags, which shrinks
+// responses like playlistinfo considerably.
+//
+// Entries received on the restricted connection record the tags in
+// PlaylistEntry.RequestedTags. Library listings use separate connections and
+// are not restricted.
+func WithTagTypes(tags ...Tag) ClientOption {
+	return func(client *ReconnectingClient) {
+		client.tagTypes = tags
+	}
+}
+
 func WithWatchSubsystems(subsystems ...Subsystem) ClientOption {
 	return func(client *ReconnectingClient) {
 		client.watchSubsystems = subsystems
@@ -82,25 +126,34 @@ func WithWatchSubsystems(subsystems ...Subsystem) ClientOption {
 
 func NewReconnectingClient(network, addr string, options ...ClientOption) (*ReconnectingClient, error) {
 	c := &ReconnectingClient{
-		network:                     network,
-		addr:                        addr,
-		keepalive:                   true,
-		pingFunc:                    RefreshCache,
-		ConnectedListeners:          NewListenerSet[*ConnectedListener](),
-		DisconnectedListeners:       NewListenerSet[*DisconnectedListener](),
-		SubsystemsChangedListeners:  NewListenerSet[*SubsystemsChangedListener](),
-		StatusChangedListeners:      NewListenerSet[*StatusChangedListener](),
-		PlaylistChangedListeners:    NewListenerSet[*PlaylistChangedListener](),
-		CurrentSongChangedListeners: NewListenerSet[*CurrentSongChangedListener](),
+		network:                      network,
+		addr:                         addr,
+		keepalive:                    true,
+		pingFunc:                     RefreshCache,
+		retryTimeout:                 10 * time.Second,
+		clock:                        systemClock{},
+		done:                         make(chan struct{}),
+		ConnectedListeners:           NewListenerSet[*ConnectedListener](),
+		DisconnectedListeners:        NewListenerSet[*DisconnectedListener](),
+		SubsystemsChangedListeners:   NewListenerSet[*SubsystemsChangedListener](),
+		StatusChangedListeners:       NewListenerSet[*StatusChangedListener](),
+		StatusFieldsChangedListeners: NewListenerSet[*StatusFieldsChangedListener](),
+		PlaylistChangedListeners:     NewListenerSet[*PlaylistChangedListener](),
+		CurrentSongChangedListeners:  NewListenerSet[*CurrentSongChangedListener](),
+		ServerInfoChangedListeners:   NewListenerSet[*ServerInfoChangedListener](),
 	}
 	for _, option := range options {
 		option(c)
 	}
 
+	c.startBridge()
+
 	if c.blocking {
 		fmt.Printf("mpd: connecting (blocking) to %s %s\n", network, addr)
 		if err := c.Connect(); err != nil {
 			fmt.Printf("mpd: connect to %s %s failed: %v\n", network, addr, err)
+			// stops the bridge
+			_ = c.Close()
 			return nil, err
 		} else {
 			fmt.Printf("mpd: connect to %s %s succeeded\n", network, addr)
@@ -109,9 +162,11 @@ func NewReconnectingClient(network, addr string, options ...ClientOption) (*Reco
 	} else {
 		fmt.Printf("mpd: connecting to %s %s in separate goroutine\n", network, addr)
 		go func() {
-			if err := c.Connect(); err != nil {
+			if err := c.Connect(); errors.Is(err, ErrClosed) {
+				fmt.Printf("mpd: background connect to %s %s aborted due to close\n", network, addr)
+			} else if err != nil {
 				fmt.Printf("mpd: background connect to %s %s failed: %v; starting reconnect...\n", network, addr, err)
-				c.reconnect()
+				c.startReconnect()
 			} else {
 				fmt.Printf("mpd: background connect to %s %s succeeded\n", network, addr)
 			}
@@ -121,104 +176,255 @@ func NewReconnectingClient(network, addr string, options ...ClientOption) (*Reco
 }
 
 func (c *ReconnectingClient) Connect() error {
-	c.connectLock.Lock()
-	defer c.connectLock.Unlock()
-
 	return c.connect()
 }
 
+// connect dials MPD and swaps in the new connection.
+//
+// The connectLock is only taken once the dial succeeded, so commands fail
+// with ErrNotConnected instead of waiting for a slow or hanging dial, and
+// Close does not wait for it either.
 func (c *ReconnectingClient) connect() error {
-	if client, err := mpd.DialAuthenticated(c.network, c.addr, c.password); err != nil {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	network, addr, password, err := c.dialAddr()
+	if err != nil {
 		return err
-	} else {
-		c.Client = client
-		c.closeCh = make(chan struct{})
-		c.isConnected.Store(true)
-		if c.keepalive {
-			c.keepaliveTicker = time.NewTicker(time.Minute)
-			go func() {
-				for {
-					select {
-					case <-c.closeCh:
+	}
+	client, err := mpd.DialAuthenticated(network, addr, password)
+	if err != nil {
+		return err
+	}
+
+	c.connectLock.Lock()
+	defer c.connectLock.Unlock()
+
+	if c.isClosed() {
+		// closed while dialing
+		_ = client.Close()
+		return ErrClosed
+	}
+	_ = c.close()
+
+	c.Client = client
+	c.loadCommands()
+	c.negotiateTagTypes()
+	c.isConnected.Store(true)
+	if c.keepalive {
+		c.keepaliveStop = make(chan struct{})
+		c.keepaliveTicker = c.clock.NewTicker(time.Minute)
+		// the fields are replaced by a reconnect, so this goroutine keeps its own
+		stop, keepaliveTicker := c.keepaliveStop, c.keepaliveTicker
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-c.done:
+					return
+				case <-keepaliveTicker.C():
+					if err := c.ping(); errors.Is(err, ErrNotConnected) {
+						return
+					} else if err != nil {
+						fmt.Printf("mpd: keepalive ping failed: %v; starting reconnect...\n", err)
+						c.startReconnect()
+						// the reconnect starts a new keepalive goroutine
 						return
-					case <-c.keepaliveTicker.C:
-						c.connectLock.RLock()
-						if err := c.pingFunc(c); err != nil {
-							c.connectLock.RUnlock()
-							fmt.Printf("mpd: keepalive ping failed: %v; starting reconnect...\n", err)
-							c.isConnected.Store(false)
-							c.reconnect()
-						} else {
-							c.connectLock.RUnlock()
-						}
 					}
 				}
-			}()
-		}
+			}
+		}()
+	}
 
-		fmt.Printf("mpd: notifying connected to %s %s\n", c.network, c.addr)
-		// allow the listeners to acquire the connectLock
-		go c.ConnectedListeners.Notify(func(l *ConnectedListener) { l.Connected(c) })
+	fmt.Printf("mpd: notifying connected to %s %s\n", c.network, c.addr)
+	// the listeners run in their own goroutines, so they can acquire the connectLock
+	c.ConnectedListeners.Notify(func(l *ConnectedListener) { l.Connected(c) })
+	go c.loadServerInfo()
 
-		if c.keepalive {
-			go c.pingFunc(c)
-		}
-		return nil
+	if c.keepalive {
+		go c.ping()
+	}
+	return nil
+}
+
+// ping runs the pingFunc with the connectLock held, unless the client was
+// closed in the meantime.
+func (c *ReconnectingClient) ping() error {
+	c.connectLock.RLock()
+	defer c.connectLock.RUnlock()
+
+	if c.Client == nil {
+		return ErrNotConnected
+	}
+	return c.pingFunc(c)
+}
+
+// startReconnect marks the client as disconnected and reconnects in the
+// background. Reconnects requested while one is running are ignored, so the
+// keepalive and failing commands can both call it.
+func (c *ReconnectingClient) startReconnect() {
+	if c.isClosed() {
+		c.notifyDisconnected()
+		return
+	}
+	if !c.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+
+	// tell the listeners right away instead of after the connectLock is free
+	c.notifyDisconnected()
+
+	go func() {
+		defer c.reconnecting.Store(false)
+		c.reconnect()
+	}()
+}
+
+// notifyDisconnected marks the client as disconnected and notifies the
+// DisconnectedListeners, unless it was disconnected already.
+func (c *ReconnectingClient) notifyDisconnected() {
+	if c.isConnected.Swap(false) {
+		fmt.Printf("mpd: notifying disconnected from %s %s\n", c.network, c.addr)
+		c.DisconnectedListeners.Notify(func(l *DisconnectedListener) { l.Disconnected(c) })
 	}
 }
 
 func (c *ReconnectingClient) reconnect() {
-	// get rid of old client
+	// get rid of old client; the connectLock is not held while dialing, so
+	// commands fail fast during long outages
 	c.connectLock.Lock()
-	defer c.connectLock.Unlock()
-
 	_ = c.close()
+	c.connectLock.Unlock()
 
-	t0 := time.Now()
+	t0 := c.clock.Now()
 connect:
 	if err := c.connect(); err != nil {
 		fmt.Printf("mpd: reconnect failed: %v\n", err)
+		if errors.Is(err, ErrClosed) {
+			return
+		}
 		select {
-		case <-c.closeCh:
+		case <-c.done:
 			fmt.Printf("mpd: reconnect aborted due to close\n")
 			return
-		case <-time.After(time.Second):
+		case <-c.clock.After(time.Second):
 			fmt.Printf("mpd: retrying connect due to failed reconnect\n")
 			goto connect
 		}
 	} else {
-		fmt.Printf("mpd: reconnect succeeded after %s\n", time.Since(t0).String())
+		fmt.Printf("mpd: reconnect succeeded after %s\n", c.clock.Now().Sub(t0).String())
 	}
 }
 
+// Close disconnects from MPD and stops the reconnect loop and the keepalive
+// for good. It does not wait for a connect in progress, whose connection is
+// discarded. It can be called more than once, and returns the result of the
+// first call.
 func (c *ReconnectingClient) Close() error {
-	close(c.closeCh) // outside connectLock
+	c.closeOnce.Do(func() {
+		// signal before taking the connectLock, which a reconnect loop holds
+		close(c.done)
 
-	c.connectLock.Lock()
-	defer c.connectLock.Unlock()
+		c.connectLock.Lock()
+		defer c.connectLock.Unlock()
+
+		c.closeErr = c.close()
+		if c.bridge != nil {
+			c.bridge.close()
+		}
+	})
+	return c.closeErr
+}
+
+// Done returns a channel that is closed when Close is called.
+func (c *ReconnectingClient) Done() <-chan struct{} {
+	return c.done
+}
 
-	return c.close()
+func (c *ReconnectingClient) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
 }
 
 func (c *ReconnectingClient) close() error {
 	if c.keepaliveTicker != nil {
 		c.keepaliveTicker.Stop()
 		c.keepaliveTicker = nil
+		close(c.keepaliveStop)
+		c.keepaliveStop = nil
 	}
 
 	if c.Client != nil {
 		err := c.Client.Close()
 		c.Client = nil
-		c.isConnected.Store(false)
-		fmt.Printf("mpd: notifying disconnected from %s %s\n", c.network, c.addr)
-		// allow the listeners to acquire the connectLock
-		go c.DisconnectedListeners.Notify(func(l *DisconnectedListener) { l.Disconnected(c) })
+		c.notifyDisconnected()
 		return err
 	}
 
 	return nil
 }
 
+// negotiateTagTypes enables only the tags set with WithTagTypes.
+//
+// Must be called with connectLock held.
+func (c *ReconnectingClient) negotiateTagTypes() {
+	c.tagTypesActive.Store(false)
+	if len(c.tagTypes) == 0 {
+		return
+	}
+
+	if err := c.Client.Command("tagtypes clear").OK(); err != nil {
+		fmt.Printf("mpd: clearing tag types failed: %v; receiving all tags\n", err)
+		return
+	}
+	if err := c.Client.Command("tagtypes enable %s", mpd.Quoted(strings.Join(StringsForTags(c.tagTypes), " "))).OK(); err != nil {
+		fmt.Printf("mpd: enabling tag types failed: %v; receiving all tags\n", err)
+		_ = c.Client.Command("tagtypes all").OK()
+		return
+	}
+	c.tagTypesActive.Store(true)
+}
+
+// requestedTags returns the tags songs received on the connection are
+// restricted to, or nil if they are not restricted.
+func (c *ReconnectingClient) requestedTags() []Tag {
+	if c.tagTypesActive.Load() {
+		return c.tagTypes
+	}
+	return nil
+}
+
+// dialRaw opens a separate connection for responses mpd.Client cannot parse.
+func (c *ReconnectingClient) dialRaw() (*rawConn, error) {
+	network, addr, password, err := c.dialAddr()
+	if err != nil {
+		return nil, err
+	}
+	return dialRaw(network, addr, password)
+}
+
+// dialAddr returns the address a connection is to be made to and the
+// password to send. If that is the bridge, it dials and authenticates with
+// MPD first, so errors are returned here, and the password is the pairing
+// token.
+func (c *ReconnectingClient) dialAddr() (string, string, string, error) {
+	password := c.currentPassword()
+	if c.bridge != nil {
+		addr, token, err := c.bridge.prepare(password)
+		if err != nil {
+			return "", "", "", err
+		}
+		return "tcp", addr, token, nil
+	}
+	return c.network, c.addr, password, nil
+}
+
 func (c *ReconnectingClient) IsConnected() bool {
 	return c.isConnected.Load()
 }
@@ -227,11 +433,16 @@ func (c *ReconnectingClient) IsConnected() bool {
 //
 // All commands must be run via Do() so they are
 // protected by the connectLock and obey correct idle behavior.
+//
+// MPD error responses are returned as *AckError. Connection-level errors
+// (see IsTransient) start a reconnect, and permission errors make the
+// connection authenticate again if the PasswordProvider has a new password.
 func (c *ReconnectingClient) Do(fn func(client *ReconnectingClient) error) error {
 	c.connectLock.RLock()
 	defer c.connectLock.RUnlock()
 
-	if c.Client == nil {
+	if c.Client == nil || !c.isConnected.Load() {
+		// a connection marked as lost is not used until the reconnect replaced it
 		return ErrNotConnected
 	} else {
 		// TODO
@@ -261,10 +472,75 @@ func (c *ReconnectingClient) Do(fn func(client *ReconnectingClient) error) error
 		//		c.idleStateLock.Unlock()
 		//	}()
 		//}
-		return fn(c)
+		err := asAckError(fn(c))
+		if IsTransient(err) && !errors.Is(err, ErrNotConnected) {
+			c.connectionLost(err)
+		} else if errors.Is(err, ErrAckPermission) {
+			// the command was denied, but may succeed with a rotated password
+			if authErr := c.reauthenticate(); authErr != nil && !errors.Is(authErr, errPasswordUnchanged) {
+				fmt.Printf("mpd: re-authentication failed: %v\n", authErr)
+			}
+		}
+		return err
 	}
 }
 
+// DoIdempotent runs a client command like Do(), but if it fails with a
+// connection-level error (see IsTransient), waits for the reconnect and runs it
+// again, until the retry timeout is exceeded. After a permission error, it is
+// run once more if Do authenticated with a new password.
+//
+// fn must be safe to run more than once: it may have been executed by MPD
+// before the connection broke. Commands like add or next are not, and must be
+// run via Do() instead.
+func (c *ReconnectingClient) DoIdempotent(fn func(client *ReconnectingClient) error) error {
+	deadline := c.clock.Now().Add(c.retryTimeout)
+	permissionRetried := false
+	for {
+		// listen before running the command, so a quick reconnect is not missed
+		connected := make(chan struct{}, 1)
+		listener := NewConnectedListener(func(client *ReconnectingClient) {
+			select {
+			case connected <- struct{}{}:
+			default:
+			}
+		})
+		c.ConnectedListeners.Add(listener)
+
+		reauthentications := c.reauthentications.Load()
+		err := c.Do(fn)
+		if errors.Is(err, ErrAckPermission) && !permissionRetried && c.reauthentications.Load() != reauthentications {
+			// Do has authenticated again, and MPD did not run the denied command
+			c.ConnectedListeners.Remove(listener)
+			permissionRetried = true
+			continue
+		} else if !IsTransient(err) {
+			c.ConnectedListeners.Remove(listener)
+			return err
+		}
+
+		fmt.Printf("mpd: idempotent command failed: %v; waiting for reconnect to retry\n", err)
+		select {
+		case <-connected:
+			c.ConnectedListeners.Remove(listener)
+		case <-c.done:
+			c.ConnectedListeners.Remove(listener)
+			return err
+		case <-c.clock.After(deadline.Sub(c.clock.Now())):
+			c.ConnectedListeners.Remove(listener)
+			fmt.Printf("mpd: giving up on idempotent command after %s\n", c.retryTimeout.String())
+			return err
+		}
+	}
+}
+
+// connectionLost starts a reconnect after a command failed with a
+// connection-level error, instead of waiting for the keepalive to notice.
+func (c *ReconnectingClient) connectionLost(err error) {
+	fmt.Printf("mpd: command failed: %v; starting reconnect...\n", err)
+	c.startReconnect()
+}
+
 func (c *ReconnectingClient) idle(subsystems ...Subsystem) ([]Subsystem, error) {
 	changed, err := c.Command("idle %s", mpd.Quoted(strings.Join(StringsForSubsystems(subsystems), " "))).Strings("changed")
 	return SubsystemsForStrings(changed), err
@@ -286,38 +562,48 @@ func Ping(client *ReconnectingClient) error {
 func RefreshCache(client *ReconnectingClient) error {
 	// This will get called only once per keep-alive for the mpd client instance,
 	// so we use listeners to get it to all interested action instances.
+	// Concurrent refreshes are serialized, so the caches are swapped in order.
+	client.refreshLock.Lock()
+	defer client.refreshLock.Unlock()
+
 	if attrs, err := client.Status(); err != nil {
 		return err
 	} else {
 		status := ParseStatusAttrs(attrs)
 		oldStatus := client.StatusCache.Swap(status)
 
-		if oldStatus == nil || status.Playlist != oldStatus.Playlist {
+		// an optimistic playlist is replaced by the one MPD reports, even if the
+		// edit did not change the playlist version
+		cachedPlaylist := client.PlaylistCache.Load()
+		if cachedPlaylist == nil || status.Playlist != cachedPlaylist.Version || cachedPlaylist.Optimistic {
 			fmt.Printf("mpd: playlist id changed to %d\n", status.Playlist)
-			if attrsList, err := client.PlaylistInfo(-1, -1); err != nil {
+			if newPlaylist, err := loadPlaylist(client, cachedPlaylist, status); err != nil {
 				return err
 			} else {
-				fmt.Printf("mpd: received new playlist #%d len=%d\n", status.Playlist, len(attrsList))
-				newPlaylist := NewPlaylist(attrsList)
+				fmt.Printf("mpd: received new playlist #%d len=%d\n", status.Playlist, len(newPlaylist.Entries))
 				client.PlaylistCache.Store(newPlaylist)
 
-				go client.PlaylistChangedListeners.Notify(func(l *PlaylistChangedListener) {
+				client.PlaylistChangedListeners.Notify(func(l *PlaylistChangedListener) {
 					l.PlaylistChanged(client, newPlaylist)
 				})
 			}
 		}
 
-		if oldStatus == nil || !status.Equals(oldStatus) {
-			fmt.Printf("mpd: status changed (%v)\n", deep.Equal(oldStatus, status))
-			go client.StatusChangedListeners.Notify(func(l *StatusChangedListener) {
+		if changed := status.Diff(oldStatus); changed != 0 {
+			fmt.Printf("mpd: status changed (%v)\n", changed)
+			client.StatusChangedListeners.Notify(func(l *StatusChangedListener) {
 				l.StatusChanged(client, status)
 			})
+			change := &StatusChange{Old: oldStatus, New: status, Changed: changed}
+			client.StatusFieldsChangedListeners.notifyFields(changed, func(l *StatusFieldsChangedListener) {
+				l.StatusFieldsChanged(client, change)
+			})
 
 			currentSong := NewCurrentSong(status, client.PlaylistCache.Load())
 			oldCurrentSong := client.CurrentSongCache.Swap(currentSong)
 			if oldCurrentSong == nil || !currentSong.Equals(oldCurrentSong) {
-				fmt.Printf("mpd: current song changed (%v): %#v\n", deep.Equal(oldCurrentSong, currentSong), currentSong)
-				go client.CurrentSongChangedListeners.Notify(func(l *CurrentSongChangedListener) {
+				fmt.Printf("mpd: current song changed: %#v\n", currentSong)
+				client.CurrentSongChangedListeners.Notify(func(l *CurrentSongChangedListener) {
 					l.CurrentSongChanged(client, currentSong)
 				})
 			}
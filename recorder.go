@@ -0,0 +1,110 @@
+package mmpd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linkdata/deadlock"
+)
+
+// Recorder records the raw protocol exchange of a ReconnectingClient, e.g.
+// to attach to a bug report or to replay with mpdtest.ReplayServer.
+//
+// The recording is text, with one line per chunk of data read or written:
+//
+//	1 > "status\n"
+//	1 < "volume: 50\nrepeat: 0\n...OK\n"
+//	1 closed
+//
+// The number identifies the connection, in the order they were opened; ">"
+// is data sent to MPD and "<" data received, quoted as Go strings. The
+// arguments of password commands are replaced with "redacted".
+type Recorder struct {
+	lock  deadlock.Mutex
+	w     io.Writer
+	conns int
+	err   error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// WithRecorder records all connections of the client, including the separate
+// connections for listings and batches, with recorder.
+func WithRecorder(recorder *Recorder) ClientOption {
+	return func(client *ReconnectingClient) {
+		client.recorder = recorder
+	}
+}
+
+// Err returns the first error writing the recording.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err
+}
+
+// Wrap returns conn recording its data as a new connection.
+func (r *Recorder) Wrap(conn net.Conn) net.Conn {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.conns++
+	return &recordedConn{Conn: conn, recorder: r, id: r.conns}
+}
+
+func (r *Recorder) record(id int, event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, "%d %s\n", id, event)
+	}
+}
+
+type recordedConn struct {
+	net.Conn
+	recorder  *Recorder
+	id        int
+	closeOnce sync.Once
+}
+
+func (rc *recordedConn) Read(p []byte) (int, error) {
+	n, err := rc.Conn.Read(p)
+	if n > 0 {
+		rc.recorder.record(rc.id, "< "+strconv.Quote(string(p[:n])))
+	}
+	return n, err
+}
+
+func (rc *recordedConn) Write(p []byte) (int, error) {
+	rc.recorder.record(rc.id, "> "+strconv.Quote(redactPasswords(string(p))))
+	return rc.Conn.Write(p)
+}
+
+func (rc *recordedConn) Close() error {
+	rc.closeOnce.Do(func() {
+		rc.recorder.record(rc.id, "closed")
+	})
+	return rc.Conn.Close()
+}
+
+// redactPasswords replaces the arguments of the password commands in data.
+func redactPasswords(data string) string {
+	lines := strings.SplitAfter(data, "\n")
+	for idx, line := range lines {
+		if strings.HasPrefix(line, "password ") {
+			lines[idx] = `password "redacted"`
+			if strings.HasSuffix(line, "\n") {
+				lines[idx] += "\n"
+			}
+		}
+	}
+	return strings.Join(lines, "")
+}
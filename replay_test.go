@@ -0,0 +1,193 @@
+package mmpd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkke/mmpd"
+	"github.com/mkke/mmpd/mpdtest"
+)
+
+const radioURL = "http://radio.example.com:8000/live?format=.flac"
+
+// radioStatus returns the status lines of a radio stream, which has no
+// duration and a floating point audio format, based on the status of srv.
+func radioStatus(t *testing.T, srv *mpdtest.Server, elapsed, bitrate, audio string) []string {
+	t.Helper()
+
+	lines, err := srv.Exec("status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status []string
+	for _, line := range lines {
+		key, _, _ := strings.Cut(line, ": ")
+		switch key {
+		case "time", "elapsed", "duration", "bitrate", "audio":
+		default:
+			status = append(status, line)
+		}
+	}
+	return append(status, "mixrampdelay: nan", "time: "+strings.Split(elapsed, ".")[0]+":0",
+		"elapsed: "+elapsed, "bitrate: "+bitrate, "audio: "+audio)
+}
+
+// runRadioSession follows a radio stream: the client refreshes its caches
+// once per status of the stream.
+func runRadioSession(t *testing.T, client *mmpd.ReconnectingClient, setStatus func(step int)) {
+	t.Helper()
+
+	// the server info is queried in the background after connecting
+	eventually(t, "server info", func() bool { return client.ServerInfoCache.Load() != nil })
+	for step := 0; step < 2; step++ {
+		setStatus(step)
+		if err := client.ReloadStatus(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// recordRadioSession records runRadioSession against a fake server to file.
+func recordRadioSession(t *testing.T, file string) {
+	t.Helper()
+
+	srv := startServerWith(t, mpdtest.WithPassword("secret"))
+	exec(t, srv, `add "`+radioURL+`"`, "play")
+	// the tags MPD reports once the stream plays
+	srv.Handle("playlistinfo", func([]string) ([]string, error) {
+		return []string{"file: " + radioURL, "Name: Rädio Ëxample", `Title: Artist - Title (Live) ; feat. "Other"`,
+			"Track: 0/", "Genre: Pop;Rock", "Pos: 0", "Id: 1"}, nil
+	})
+	statuses := [][]string{
+		radioStatus(t, srv, "12.345", "320", "44100:f:2"),
+		radioStatus(t, srv, "13.901", "128", "48000:f:2"),
+	}
+
+	var recording bytes.Buffer
+	recorder := mmpd.NewRecorder(&recording)
+	client := connect(t, srv, mmpd.WithPassword("secret"), mmpd.WithRecorder(recorder))
+	runRadioSession(t, client, func(step int) {
+		srv.Handle("status", func([]string) ([]string, error) {
+			return statuses[step], nil
+		})
+	})
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, recording.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorderRedactsPasswords(t *testing.T) {
+	srv := startServer(t, mpdtest.WithPassword("secret"))
+	var recording bytes.Buffer
+	recorder := mmpd.NewRecorder(&recording)
+	client := connect(t, srv, mmpd.WithPassword("secret"), mmpd.WithRecorder(recorder))
+	if err := client.Do(mmpd.Ping); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+
+	if strings.Contains(recording.String(), "secret") {
+		t.Errorf("password recorded:\n%s", recording.String())
+	}
+	if !strings.Contains(recording.String(), `password \"redacted\"\n`) {
+		t.Errorf("no redacted password recorded:\n%s", recording.String())
+	}
+}
+
+func TestReplayRadioSession(t *testing.T) {
+	file := filepath.Join("testdata", "radio.recording")
+	if *update {
+		recordRadioSession(t, file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	recording, err := mpdtest.ReadRecording(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statusExchanges := recording.Exchanges("status")
+	if len(statusExchanges) != 2 {
+		t.Fatalf("%d status exchanges recorded", len(statusExchanges))
+	}
+	status := mmpd.ParseStatusAttrs(statusExchanges[0].Attrs())
+	if status.MixRampDelay != 0 || len(status.ParseErrors) != 1 || status.Duration != 0 || status.Bitrate != 320 ||
+		status.AudioFormat != (mmpd.AudioFormat{SampleRate: 44100, SampleFormat: mmpd.SampleFormatFloat, Channels: 2}) {
+		t.Errorf("status %+v", status)
+	}
+	playlistExchanges := recording.Exchanges("playlistinfo")
+	if len(playlistExchanges) != 1 || len(playlistExchanges[0].AttrsList("file")) != 1 {
+		t.Fatalf("playlistinfo exchanges %+v", playlistExchanges)
+	}
+	entry := mmpd.ParsePlaylistEntryAttrs(playlistExchanges[0].AttrsList("file")[0])
+	if entry.File != radioURL || entry.Name != "Rädio Ëxample" || entry.Title != `Artist - Title (Live) ; feat. "Other"` ||
+		entry.Length() != 0 || entry.IsLossless() || entry.TrackNumbering != (mmpd.Numbering{Raw: "0/"}) {
+		t.Errorf("entry %+v", entry)
+	}
+
+	srv, err := mpdtest.NewReplayServer(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	client := connect(t, srv, mmpd.WithPassword("other"))
+
+	statuses := make(chan *mmpd.Status, 10)
+	client.StatusChangedListeners.Add(mmpd.NewStatusChangedListener(func(_ *mmpd.ReconnectingClient, status *mmpd.Status) {
+		statuses <- status
+	}))
+	playlists := make(chan *mmpd.Playlist, 10)
+	client.PlaylistChangedListeners.Add(mmpd.NewPlaylistChangedListener(func(_ *mmpd.ReconnectingClient, playlist *mmpd.Playlist) {
+		playlists <- playlist
+	}))
+	currentSongs := make(chan *mmpd.CurrentSong, 10)
+	client.CurrentSongChangedListeners.Add(mmpd.NewCurrentSongChangedListener(func(_ *mmpd.ReconnectingClient, currentSong *mmpd.CurrentSong) {
+		currentSongs <- currentSong
+	}))
+
+	runRadioSession(t, client, func(int) {})
+	_ = client.Close()
+	_ = srv.Close()
+	if err := srv.Err(); err != nil {
+		t.Error(err)
+	}
+	if n := srv.Unused(); n != 0 {
+		t.Errorf("%d recorded connections not replayed", n)
+	}
+
+	for _, want := range []struct {
+		bitrate int
+		audio   string
+	}{{320, "44100:f:2"}, {128, "48000:f:2"}} {
+		if status := receive(t, statuses); status.Bitrate != want.bitrate || status.Audio != want.audio || status.MixRampDelay != 0 {
+			t.Errorf("status %+v, want bitrate %d and audio %s", status, want.bitrate, want.audio)
+		}
+	}
+	if playlist := receive(t, playlists); len(playlist.Entries) != 1 || playlist.Entries[0].Name != "Rädio Ëxample" {
+		t.Errorf("playlist %+v", playlist)
+	}
+	if currentSong := receive(t, currentSongs); currentSong.CurrentSong == nil || currentSong.CurrentSong.File != radioURL {
+		t.Errorf("current song %+v", currentSong)
+	}
+	select {
+	case status := <-statuses:
+		t.Errorf("unexpected status %+v", status)
+	case playlist := <-playlists:
+		t.Errorf("unexpected playlist %+v", playlist)
+	case currentSong := <-currentSongs:
+		t.Errorf("unexpected current song %+v", currentSong)
+	default:
+	}
+}
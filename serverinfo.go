@@ -0,0 +1,189 @@
+package mmpd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedByServer is returned for features the connected MPD is too old for.
+var ErrUnsupportedByServer = errors.New("not supported by server")
+
+// ProtocolVersion is the MPD protocol version announced in the greeting.
+type ProtocolVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func ParseProtocolVersion(s string) ProtocolVersion {
+	var v ProtocolVersion
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 3)
+	if len(parts) > 0 {
+		v.Major, _ = strconv.Atoi(parts[0])
+	}
+	if len(parts) > 1 {
+		v.Minor, _ = strconv.Atoi(parts[1])
+	}
+	if len(parts) > 2 {
+		v.Patch, _ = strconv.Atoi(parts[2])
+	}
+	return v
+}
+
+func (v ProtocolVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor or newer.
+func (v ProtocolVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Decoder is a decoder plugin and the file types it handles.
+type Decoder struct {
+	Plugin    string
+	Suffixes  []string
+	MimeTypes []string
+}
+
+// ServerInfo describes the capabilities of the connected MPD.
+type ServerInfo struct {
+	// the protocol version from the greeting
+	Version ProtocolVersion
+
+	// the commands the connection is permitted to run
+	Commands CommandSet
+
+	// the tag types the server supports, as reported by tagtypes
+	TagTypes []Tag
+
+	// the URL schemes the server can play, e.g. "http://"
+	URLHandlers []string
+
+	// the decoder plugins of the server
+	Decoders []Decoder
+}
+
+// SupportsFilters reports whether the server understands filter expressions (MPD 0.21).
+func (si *ServerInfo) SupportsFilters() bool {
+	return si == nil || si.Version.AtLeast(0, 21)
+}
+
+// SupportsTagType reports whether the server supports tag.
+func (si *ServerInfo) SupportsTagType(tag Tag) bool {
+	if si == nil || si.TagTypes == nil {
+		return true
+	}
+	for _, t := range si.TagTypes {
+		if strings.EqualFold(string(t), string(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRun reports whether the server supports command and permits it.
+func (si *ServerInfo) CanRun(command string) bool {
+	return si == nil || si.Commands == nil || si.Commands.Contains(command)
+}
+
+// loadServerInfo queries the server capabilities after a connect and
+// notifies the ServerInfoChangedListeners if the server version changed.
+func (c *ReconnectingClient) loadServerInfo() {
+	info := &ServerInfo{}
+	if err := c.Do(func(client *ReconnectingClient) error {
+		info.Version = ParseProtocolVersion(client.Version())
+		info.Commands = client.Commands()
+
+		if handlers, err := client.Command("urlhandlers").Strings("handler"); err != nil {
+			return err
+		} else {
+			info.URLHandlers = handlers
+		}
+		return nil
+	}); err != nil {
+		fmt.Printf("mpd: querying server info failed: %v\n", err)
+		return
+	}
+
+	// tagtypes on the main connection only reports the tags enabled with
+	// WithTagTypes, and decoders repeats keys per plugin, which mpd.Client
+	// cannot parse
+	if err := c.loadRawServerInfo(info); err != nil {
+		fmt.Printf("mpd: querying tag types and decoders failed: %v\n", err)
+	}
+
+	oldInfo := c.ServerInfoCache.Swap(info)
+	if oldInfo == nil || oldInfo.Version != info.Version {
+		fmt.Printf("mpd: server protocol version is %s\n", info.Version)
+		c.ServerInfoChangedListeners.Notify(func(l *ServerInfoChangedListener) {
+			l.ServerInfoChanged(c, info)
+		})
+	}
+}
+
+// loadRawServerInfo queries the tag types and decoders on a separate connection.
+func (c *ReconnectingClient) loadRawServerInfo(info *ServerInfo) error {
+	conn, err := c.dialRaw()
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	if info.TagTypes, err = loadTagTypes(conn); err != nil {
+		return err
+	}
+	info.Decoders, err = loadDecoders(conn)
+	return err
+}
+
+func loadTagTypes(conn *rawConn) ([]Tag, error) {
+	if err := conn.command("tagtypes"); err != nil {
+		return nil, err
+	}
+
+	var tagTypes []Tag
+	for {
+		key, value, ok, err := conn.readPair()
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return tagTypes, nil
+		}
+
+		if key == "tagtype" {
+			tagTypes = append(tagTypes, Tag(value))
+		}
+	}
+}
+
+func loadDecoders(conn *rawConn) ([]Decoder, error) {
+	if err := conn.command("decoders"); err != nil {
+		return nil, err
+	}
+
+	var decoders []Decoder
+	for {
+		key, value, ok, err := conn.readPair()
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return decoders, nil
+		}
+
+		switch key {
+		case "plugin":
+			decoders = append(decoders, Decoder{Plugin: value})
+		case "suffix":
+			if len(decoders) > 0 {
+				decoders[len(decoders)-1].Suffixes = append(decoders[len(decoders)-1].Suffixes, value)
+			}
+		case "mime_type":
+			if len(decoders) > 0 {
+				decoders[len(decoders)-1].MimeTypes = append(decoders[len(decoders)-1].MimeTypes, value)
+			}
+		}
+	}
+}
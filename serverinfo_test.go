@@ -0,0 +1,21 @@
+package mmpd_test
+
+import (
+	"testing"
+
+	"github.com/mkke/mmpd"
+)
+
+func TestServerInfoWithTagTypes(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv, mmpd.WithTagTypes(mmpd.TagTitle))
+
+	eventually(t, "server info", func() bool { return client.ServerInfoCache.Load() != nil })
+	info := client.ServerInfoCache.Load()
+	if !info.SupportsTagType(mmpd.TagAlbum) || !info.SupportsTagType(mmpd.TagTitle) {
+		t.Errorf("tag types restricted to the negotiated ones: %v", info.TagTypes)
+	}
+	if info.Version != mmpd.ParseProtocolVersion("0.23.5") || !info.CanRun("plchanges") {
+		t.Errorf("unexpected server info %+v", info)
+	}
+}
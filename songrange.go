@@ -0,0 +1,121 @@
+package mmpd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SongRange is the portion of a song file a queue item plays, as sent by
+// MPD in the form "START-END" or "START-" (open ended).
+type SongRange struct {
+	Start time.Duration
+
+	// 0 if open ended
+	End time.Duration
+}
+
+// ParseSongRange parses s. An empty s is the zero SongRange, which covers
+// the whole song.
+func ParseSongRange(s string) (SongRange, error) {
+	var r SongRange
+	if s == "" {
+		return r, nil
+	}
+
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return r, fmt.Errorf("invalid song range '%s'", s)
+	}
+	var err error
+	if start != "" {
+		if r.Start, err = parseSeconds(start); err != nil {
+			return SongRange{}, fmt.Errorf("invalid song range '%s': %w", s, err)
+		}
+	}
+	if end != "" {
+		if r.End, err = parseSeconds(end); err != nil {
+			return SongRange{}, fmt.Errorf("invalid song range '%s': %w", s, err)
+		}
+		if r.End < r.Start {
+			return SongRange{}, fmt.Errorf("invalid song range '%s': end before start", s)
+		}
+	}
+	return r, nil
+}
+
+func (r SongRange) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	s := formatSeconds(r.Start) + "-"
+	if !r.IsOpen() {
+		s += formatSeconds(r.End)
+	}
+	return s
+}
+
+// protocolString formats r the way playlistinfo reports ranges, with
+// millisecond precision, e.g. "60.000-120.500".
+func (r SongRange) protocolString() string {
+	if r.IsZero() {
+		return ""
+	}
+	s := strconv.FormatFloat(r.Start.Seconds(), 'f', 3, 64) + "-"
+	if !r.IsOpen() {
+		s += strconv.FormatFloat(r.End.Seconds(), 'f', 3, 64)
+	}
+	return s
+}
+
+// IsZero reports whether r covers the whole song.
+func (r SongRange) IsZero() bool {
+	return r == SongRange{}
+}
+
+// IsOpen reports whether r extends to the end of the song.
+func (r SongRange) IsOpen() bool {
+	return r.End == 0
+}
+
+// Duration returns the length of r within a song of length total. If total
+// is unknown (0), the length of an open ended range is 0.
+func (r SongRange) Duration(total time.Duration) time.Duration {
+	end := r.End
+	if r.IsOpen() || (total > 0 && end > total) {
+		end = total
+	}
+	if end <= r.Start {
+		return 0
+	}
+	return end - r.Start
+}
+
+// parseSeconds parses fractional seconds, as used throughout the protocol.
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	} else if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid seconds '%s'", s)
+	}
+	return time.Duration(math.Round(f * float64(time.Second))), nil
+}
+
+// secondsToDuration converts fractional seconds to a duration, rounded to
+// microseconds as MPD sends at most millisecond precision.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Microsecond)
+}
+
+// parseTimestamp parses an ISO 8601 time stamp, returning the zero time if
+// it is empty or invalid.
+func parseTimestamp(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
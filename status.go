@@ -2,8 +2,10 @@ package mmpd
 
 import (
 	"fmt"
-	"reflect"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fhs/gompd/v2/mpd"
 )
@@ -52,11 +54,14 @@ type Status struct {
 	// total time elapsed (of current playing/paused song) in seconds (deprecated, use elapsed instead)
 	Time int
 
+	// total time of the current song in seconds, sent along with time (deprecated, use duration instead)
+	TotalTime int
+
 	// Total time elapsed within the current song in seconds, but with higher resolution.
-	Elapsed float32
+	Elapsed float64
 
 	// Duration of the current song in seconds.
-	Duration int
+	Duration float64
 
 	// instantaneous bitrate in kbps
 	Bitrate int
@@ -65,33 +70,99 @@ type Status struct {
 	CrossFade int
 
 	// mixramp threshold in dB
-	MixRampDB int
+	MixRampDB float64
 
-	// mixrampdelay in seconds
-	MixRampDelay int
+	// mixrampdelay in seconds; 0 if MixRamp is disabled
+	MixRampDelay float64
 
 	// The format emitted by the decoder plugin during playback, format: samplerate:bits:channels. See Global Audio Format for a detailed explanation.
 	Audio string
 
+	// Audio parsed; zero if Audio is empty or invalid
+	AudioFormat AudioFormat
+
 	// Job id
 	UpdatingDB string
 
 	// if there is an error, returns message here
 	Error string
+
+	// the name of the last stored playlist loaded into the queue
+	LastLoadedPlaylist string
+
+	// attributes not known to this package, by name
+	Extra map[string]string
+
+	// errors parsing attribute values; the affected fields are left at zero
+	ParseErrors []error `equals:"-"`
+}
+
+// StatusChange describes a status update.
+type StatusChange struct {
+	// the previous status, nil after connecting
+	Old *Status
+
+	New *Status
+
+	// the fields that differ between Old and New
+	Changed StatusField
+}
+
+// Has reports whether any of fields changed.
+func (sc *StatusChange) Has(fields StatusField) bool {
+	return sc.Changed&fields != 0
+}
+
+// StatusOptionFields are the playback options of Status.
+const StatusOptionFields = StatusRepeat | StatusRandom | StatusSingle | StatusConsume | StatusCrossFade | StatusMixRampDB | StatusMixRampDelay
+
+// ElapsedTime returns the time elapsed within the current song.
+func (s *Status) ElapsedTime() time.Duration {
+	return secondsToDuration(s.Elapsed)
 }
 
-func (s *Status) Equals(other *Status) bool {
-	return reflect.DeepEqual(s, other)
+// DurationTime returns the duration of the current song.
+func (s *Status) DurationTime() time.Duration {
+	return secondsToDuration(s.Duration)
+}
+
+// Remaining returns the time until the end of the current song, or 0 if the
+// duration is unknown.
+func (s *Status) Remaining() time.Duration {
+	if remaining := s.DurationTime() - s.ElapsedTime(); remaining > 0 {
+		return remaining
+	}
+	return 0
 }
 
 func ParseStatusAttrs(attrs mpd.Attrs) *Status {
 	status := &Status{}
+
+	parseInt := func(k, v string, dst *int) {
+		if i, err := strconv.Atoi(v); err != nil {
+			status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: %w", k, err))
+		} else {
+			*dst = i
+		}
+	}
+	parseFloat := func(k, v string, dst *float64) {
+		if f, err := strconv.ParseFloat(v, 64); err != nil {
+			status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: %w", k, err))
+		} else if math.IsNaN(f) || math.IsInf(f, 0) {
+			// e.g. mixrampdelay is "nan" while MixRamp is disabled; NaN never
+			// equals itself, so the status would always look changed
+			status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: '%s' is not a number, treated as unset", k, v))
+		} else {
+			*dst = f
+		}
+	}
+
 	for k, v := range attrs {
 		switch k {
 		case "partition":
 			status.Partition = v
 		case "volume":
-			status.Volume, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.Volume)
 		case "repeat":
 			status.Repeat = v == "1"
 		case "random":
@@ -101,48 +172,77 @@ func ParseStatusAttrs(attrs mpd.Attrs) *Status {
 		case "consume":
 			status.Consume = ParseOffOnOneshot(v)
 		case "playlist":
-			if i, err := strconv.ParseUint(v, 10, 32); err == nil {
+			if i, err := strconv.ParseUint(v, 10, 32); err != nil {
+				status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: %w", k, err))
+			} else {
 				status.Playlist = uint32(i)
 			}
 		case "playlistlength":
-			if i, err := strconv.ParseInt(v, 10, 32); err == nil {
-				status.PlaylistLength = int(i)
-			}
+			parseInt(k, v, &status.PlaylistLength)
 		case "state":
 			status.State = PlayerState(v)
 		case "song":
-			status.Song, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.Song)
 		case "songid":
-			status.SongId, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.SongId)
 		case "nextsong":
-			status.NextSong, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.NextSong)
 		case "nextsongid":
-			status.NextSongId, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.NextSongId)
 		case "time":
-			status.Time, _ = strconv.Atoi(v)
+			// elapsed:total
+			elapsed, total, _ := strings.Cut(v, ":")
+			parseInt(k, elapsed, &status.Time)
+			if total != "" {
+				parseInt(k, total, &status.TotalTime)
+			}
 		case "elapsed":
-			if f, err := strconv.ParseFloat(v, 32); err == nil {
-				status.Elapsed = float32(f)
+			if d, err := parseSeconds(v); err != nil {
+				status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: %w", k, err))
+			} else {
+				status.Elapsed = d.Seconds()
 			}
 		case "duration":
-			status.Duration, _ = strconv.Atoi(v)
+			if d, err := parseSeconds(v); err != nil {
+				status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: %w", k, err))
+			} else {
+				status.Duration = d.Seconds()
+			}
 		case "bitrate":
-			status.Bitrate, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.Bitrate)
 		case "xfade":
-			status.CrossFade, _ = strconv.Atoi(v)
+			parseInt(k, v, &status.CrossFade)
 		case "mixrampdb":
-			status.MixRampDB, _ = strconv.Atoi(v)
+			parseFloat(k, v, &status.MixRampDB)
 		case "mixrampdelay":
-			status.MixRampDelay, _ = strconv.Atoi(v)
+			parseFloat(k, v, &status.MixRampDelay)
 		case "audio":
 			status.Audio = v
+			if af, err := ParseAudioFormat(v); err != nil {
+				status.ParseErrors = append(status.ParseErrors, fmt.Errorf("status attribute %s: %w", k, err))
+			} else {
+				status.AudioFormat = af
+			}
 		case "updating_db":
 			status.UpdatingDB = v
 		case "error":
 			status.Error = v
+		case "lastloadedplaylist":
+			status.LastLoadedPlaylist = v
 		default:
-			fmt.Printf("Unknown status attribute '%s' => '%s'\n", k, v)
+			if status.Extra == nil {
+				status.Extra = make(map[string]string)
+			}
+			status.Extra[k] = v
 		}
 	}
+
+	// older servers only send time
+	if status.Duration == 0 && status.TotalTime > 0 {
+		status.Duration = float64(status.TotalTime)
+	}
+	if status.Elapsed == 0 && status.Time > 0 {
+		status.Elapsed = float64(status.Time)
+	}
 	return status
 }
@@ -0,0 +1,81 @@
+package mmpd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fhs/gompd/v2/mpd"
+	"github.com/mkke/mmpd"
+)
+
+func TestParseStatusAttrsNaN(t *testing.T) {
+	attrs := mpd.Attrs{"mixrampdb": "0.000000", "mixrampdelay": "nan", "volume": "50"}
+	a, b := mmpd.ParseStatusAttrs(attrs), mmpd.ParseStatusAttrs(attrs)
+	if a.MixRampDelay != 0 || len(a.ParseErrors) != 1 {
+		t.Errorf("mixrampdelay %v, parse errors %v", a.MixRampDelay, a.ParseErrors)
+	}
+	if changed := a.Diff(b); changed != 0 {
+		t.Errorf("unchanged status differs in %v", changed)
+	}
+}
+
+func TestStatusTimes(t *testing.T) {
+	status := mmpd.ParseStatusAttrs(mpd.Attrs{"time": "36001:36002", "elapsed": "36000.123", "duration": "36001.5"})
+	if status.ElapsedTime() != 36000123*time.Millisecond || status.DurationTime() != 36001500*time.Millisecond ||
+		status.Remaining() != 1377*time.Millisecond {
+		t.Errorf("elapsed %s, duration %s, remaining %s", status.ElapsedTime(), status.DurationTime(), status.Remaining())
+	}
+
+	// the accessors follow the fields
+	status.Elapsed, status.Duration = 1.5, 2
+	if status.ElapsedTime() != 1500*time.Millisecond || status.DurationTime() != 2*time.Second {
+		t.Errorf("elapsed %s, duration %s after setting the fields", status.ElapsedTime(), status.DurationTime())
+	}
+
+	entry := mmpd.ParsePlaylistEntryAttrs(mpd.Attrs{"file": "a.flac", "duration": "181.123456", "Time": "181"})
+	if entry.Length() != 181123456*time.Microsecond {
+		t.Errorf("length %s", entry.Length())
+	}
+	entry.Duration = 60.25
+	if entry.Length() != 60250*time.Millisecond {
+		t.Errorf("length %s after setting Duration", entry.Length())
+	}
+}
+
+func TestStatusFieldsListener(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+
+	all := make(chan *mmpd.StatusChange, 10)
+	client.StatusFieldsChangedListeners.Add(mmpd.NewStatusFieldsChangedListener(func(_ *mmpd.ReconnectingClient, change *mmpd.StatusChange) {
+		all <- change
+	}))
+	volume := make(chan *mmpd.StatusChange, 10)
+	client.StatusFieldsChangedListeners.Add(mmpd.NewStatusFieldsChangedListener(func(_ *mmpd.ReconnectingClient, change *mmpd.StatusChange) {
+		volume <- change
+	}), mmpd.WithStatusFields(mmpd.StatusVolume))
+
+	for _, command := range []string{"random 1", "setvol 30", "repeat 1"} {
+		exec(t, srv, command)
+		if err := client.ReloadStatus(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []mmpd.StatusField{mmpd.StatusRandom, mmpd.StatusVolume, mmpd.StatusRepeat} {
+		if change := receive(t, all); change.Changed != want {
+			t.Errorf("changed %v, want %v", change.Changed, want)
+		}
+	}
+	if change := receive(t, volume); change.Changed != mmpd.StatusVolume || change.Old.Volume == 30 || change.New.Volume != 30 {
+		t.Errorf("unexpected volume change %+v", change)
+	}
+	select {
+	case change := <-volume:
+		t.Errorf("volume listener notified of %v", change.Changed)
+	default:
+	}
+}
@@ -0,0 +1,180 @@
+package mmpd
+
+import (
+	"context"
+)
+
+type EventKind int
+
+const (
+	EventConnected EventKind = iota
+	EventDisconnected
+	EventSubsystemsChanged
+	EventStatusChanged
+	EventPlaylistChanged
+	EventCurrentSongChanged
+)
+
+var allEventKinds = []EventKind{
+	EventConnected,
+	EventDisconnected,
+	EventSubsystemsChanged,
+	EventStatusChanged,
+	EventPlaylistChanged,
+	EventCurrentSongChanged,
+}
+
+func (k EventKind) String() string {
+	switch k {
+	case EventConnected:
+		return "Connected"
+	case EventDisconnected:
+		return "Disconnected"
+	case EventSubsystemsChanged:
+		return "SubsystemsChanged"
+	case EventStatusChanged:
+		return "StatusChanged"
+	case EventPlaylistChanged:
+		return "PlaylistChanged"
+	case EventCurrentSongChanged:
+		return "CurrentSongChanged"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is one of ConnectedEvent, DisconnectedEvent, SubsystemsChangedEvent,
+// StatusChangedEvent, PlaylistChangedEvent and CurrentSongChangedEvent.
+type Event interface {
+	Kind() EventKind
+}
+
+type ConnectedEvent struct{}
+
+type DisconnectedEvent struct{}
+
+type SubsystemsChangedEvent struct {
+	Subsystems []Subsystem
+}
+
+type StatusChangedEvent struct {
+	Status *Status
+}
+
+type PlaylistChangedEvent struct {
+	Playlist *Playlist
+}
+
+type CurrentSongChangedEvent struct {
+	CurrentSong *CurrentSong
+}
+
+func (ConnectedEvent) Kind() EventKind          { return EventConnected }
+func (DisconnectedEvent) Kind() EventKind       { return EventDisconnected }
+func (SubsystemsChangedEvent) Kind() EventKind  { return EventSubsystemsChanged }
+func (StatusChangedEvent) Kind() EventKind      { return EventStatusChanged }
+func (PlaylistChangedEvent) Kind() EventKind    { return EventPlaylistChanged }
+func (CurrentSongChangedEvent) Kind() EventKind { return EventCurrentSongChanged }
+
+// Subscribe returns a channel receiving the events of the kinds, or of all
+// kinds if none are given, in the order they happened:
+//
+//	for event := range client.Subscribe(ctx, mmpd.EventStatusChanged) {
+//		switch event := event.(type) {
+//		case mmpd.StatusChangedEvent:
+//			...
+//		}
+//	}
+//
+// The channel is closed when ctx ends or the client is closed. Events not
+// received yet are queued like for listeners, see SubscribeWith.
+func (c *ReconnectingClient) Subscribe(ctx context.Context, kinds ...EventKind) <-chan Event {
+	return c.SubscribeWith(ctx, nil, kinds...)
+}
+
+// SubscribeWith is like Subscribe, with WithQueueSize and WithOverflow
+// controlling how many events are buffered for a slow receiver, and which are
+// dropped when the buffer is full. With OverflowCoalesce, only the latest
+// event of any of the kinds is kept.
+func (c *ReconnectingClient) SubscribeWith(ctx context.Context, options []ListenerOption, kinds ...EventKind) <-chan Event {
+	config := listenerConfig{queueSize: DefaultListenerQueueSize}
+	for _, option := range options {
+		option(&config)
+	}
+	if len(kinds) == 0 {
+		kinds = allEventKinds
+	}
+
+	s := &subscription{
+		ch:   make(chan Event),
+		stop: make(chan struct{}),
+	}
+	shared := WithListenerQueue(&ListenerQueue{queue: newEventQueue("subscription", config)})
+
+	var removers []func()
+	for _, kind := range kinds {
+		switch kind {
+		case EventConnected:
+			l := NewConnectedListener(func(*ReconnectingClient) { s.send(ConnectedEvent{}) })
+			c.ConnectedListeners.Add(l, shared)
+			removers = append(removers, func() { c.ConnectedListeners.Remove(l) })
+		case EventDisconnected:
+			l := NewDisconnectedListener(func(*ReconnectingClient) { s.send(DisconnectedEvent{}) })
+			c.DisconnectedListeners.Add(l, shared)
+			removers = append(removers, func() { c.DisconnectedListeners.Remove(l) })
+		case EventSubsystemsChanged:
+			l := NewSubsystemsChangedListener(func(_ *ReconnectingClient, subsystems []Subsystem) {
+				s.send(SubsystemsChangedEvent{Subsystems: subsystems})
+			})
+			c.SubsystemsChangedListeners.Add(l, shared)
+			removers = append(removers, func() { c.SubsystemsChangedListeners.Remove(l) })
+		case EventStatusChanged:
+			l := NewStatusChangedListener(func(_ *ReconnectingClient, status *Status) {
+				s.send(StatusChangedEvent{Status: status})
+			})
+			c.StatusChangedListeners.Add(l, shared)
+			removers = append(removers, func() { c.StatusChangedListeners.Remove(l) })
+		case EventPlaylistChanged:
+			l := NewPlaylistChangedListener(func(_ *ReconnectingClient, playlist *Playlist) {
+				s.send(PlaylistChangedEvent{Playlist: playlist})
+			})
+			c.PlaylistChangedListeners.Add(l, shared)
+			removers = append(removers, func() { c.PlaylistChangedListeners.Remove(l) })
+		case EventCurrentSongChanged:
+			l := NewCurrentSongChangedListener(func(_ *ReconnectingClient, currentSong *CurrentSong) {
+				s.send(CurrentSongChangedEvent{CurrentSong: currentSong})
+			})
+			c.CurrentSongChangedListeners.Add(l, shared)
+			removers = append(removers, func() { c.CurrentSongChangedListeners.Remove(l) })
+		}
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.done:
+		}
+		// wakes up a waiting send, which Remove waits for
+		close(s.stop)
+		for _, remove := range removers {
+			remove()
+		}
+		close(s.ch)
+	}()
+	return s.ch
+}
+
+// subscription passes the events from its queue to the channel, which is
+// closed once its listeners are removed.
+type subscription struct {
+	ch   chan Event
+	stop chan struct{}
+}
+
+// send waits until the event is received or the subscription ends.
+func (s *subscription) send(event Event) {
+	select {
+	case s.ch <- event:
+	case <-s.stop:
+	}
+}
@@ -0,0 +1,158 @@
+package mmpd_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mkke/mmpd"
+)
+
+// kindsOf receives n events and returns their kinds.
+func kindsOf(t *testing.T, events <-chan mmpd.Event, n int) []mmpd.EventKind {
+	t.Helper()
+
+	kinds := make([]mmpd.EventKind, n)
+	for idx := range kinds {
+		kinds[idx] = receive(t, events).Kind()
+	}
+	return kinds
+}
+
+// closes fails the test unless events is closed within a few seconds. It
+// returns the events received before.
+func closes(t *testing.T, events <-chan mmpd.Event) []mmpd.Event {
+	t.Helper()
+
+	var received []mmpd.Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return received
+			}
+			received = append(received, event)
+		case <-timeout:
+			t.Fatal("channel not closed")
+		}
+	}
+}
+
+func TestSubscribeOrder(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := client.Subscribe(ctx)
+
+	exec(t, srv, `add "a"`, "play 1")
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	want := []mmpd.EventKind{mmpd.EventPlaylistChanged, mmpd.EventStatusChanged, mmpd.EventCurrentSongChanged}
+	if got := kindsOf(t, events, 3); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	srv.DisconnectAll()
+	_ = client.Do(mmpd.Ping)
+	want = []mmpd.EventKind{mmpd.EventDisconnected, mmpd.EventConnected}
+	if got := kindsOf(t, events, 2); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// only the kinds subscribed to
+	statuses := client.Subscribe(ctx, mmpd.EventStatusChanged)
+	exec(t, srv, `add "b"`, "next")
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := receive(t, statuses).(mmpd.StatusChangedEvent); !ok || event.Status.Song != 2 {
+		t.Errorf("got %+v, want the status", event)
+	}
+	select {
+	case event := <-statuses:
+		t.Errorf("got %v event", event.Kind())
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	// an event is waiting to be received when the context ends
+	ctx, cancel := context.WithCancel(context.Background())
+	events := client.Subscribe(ctx, mmpd.EventStatusChanged)
+	exec(t, srv, "setvol 10")
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if received := closes(t, events); len(received) > 1 {
+		t.Errorf("received %d events", len(received))
+	}
+
+	// later events are not sent on the closed channel
+	exec(t, srv, "setvol 20")
+	if err := client.ReloadStatus(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the client closes the channel too
+	events = client.Subscribe(context.Background())
+	_ = client.Close()
+	closes(t, events)
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	srv := startServer(t)
+	client := connect(t, srv)
+
+	// the receiver is slow: the first change waits to be received while the
+	// others are queued
+	volumes := func(options ...mmpd.ListenerOption) []int {
+		t.Helper()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := client.SubscribeWith(ctx, options, mmpd.EventStatusChanged)
+		for volume := 10; volume <= 40; volume += 10 {
+			exec(t, srv, fmt.Sprintf("setvol %d", volume))
+			if err := client.ReloadStatus(); err != nil {
+				t.Fatal(err)
+			}
+			if volume == 10 {
+				// let the first event be taken from the queue
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+
+		var volumes []int
+		for {
+			select {
+			case event := <-events:
+				volumes = append(volumes, event.(mmpd.StatusChangedEvent).Status.Volume)
+			case <-time.After(50 * time.Millisecond):
+				return volumes
+			}
+		}
+	}
+
+	if got := volumes(); fmt.Sprint(got) != "[10 20 30 40]" {
+		t.Errorf("room for all: got volumes %v", got)
+	}
+	if got := volumes(mmpd.WithQueueSize(1), mmpd.WithOverflow(mmpd.OverflowDropOldest)); fmt.Sprint(got) != "[10 40]" {
+		t.Errorf("drop oldest: got volumes %v", got)
+	}
+	if got := volumes(mmpd.WithQueueSize(1), mmpd.WithOverflow(mmpd.OverflowDropNewest)); fmt.Sprint(got) != "[10 20]" {
+		t.Errorf("drop newest: got volumes %v", got)
+	}
+	// only the latest change is kept, however large the queue
+	if got := volumes(mmpd.WithOverflow(mmpd.OverflowCoalesce)); fmt.Sprint(got) != "[10 40]" {
+		t.Errorf("coalesce: got volumes %v", got)
+	}
+}
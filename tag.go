@@ -0,0 +1,74 @@
+package mmpd
+
+// Tag is the name of a song metadata tag as used by MPD.
+type Tag string
+
+func TagsForStrings(strs []string) (tags []Tag) {
+	for _, s := range strs {
+		tags = append(tags, Tag(s))
+	}
+	return tags
+}
+
+func StringsForTags(tags []Tag) (strings []string) {
+	for _, t := range tags {
+		strings = append(strings, string(t))
+	}
+	return strings
+}
+
+// Tags as listed by the tagtypes command. See PlaylistEntry for their meaning.
+const (
+	TagArtist                    Tag = "Artist"
+	TagArtistSort                Tag = "ArtistSort"
+	TagAlbum                     Tag = "Album"
+	TagAlbumSort                 Tag = "AlbumSort"
+	TagAlbumArtist               Tag = "AlbumArtist"
+	TagAlbumArtistSort           Tag = "AlbumArtistSort"
+	TagTitle                     Tag = "Title"
+	TagTitleSort                 Tag = "TitleSort"
+	TagTrack                     Tag = "Track"
+	TagName                      Tag = "Name"
+	TagGenre                     Tag = "Genre"
+	TagMood                      Tag = "Mood"
+	TagDate                      Tag = "Date"
+	TagOriginalDate              Tag = "OriginalDate"
+	TagComposer                  Tag = "Composer"
+	TagComposerSort              Tag = "ComposerSort"
+	TagPerformer                 Tag = "Performer"
+	TagConductor                 Tag = "Conductor"
+	TagWork                      Tag = "Work"
+	TagEnsemble                  Tag = "Ensemble"
+	TagMovement                  Tag = "Movement"
+	TagMovementNumber            Tag = "MovementNumber"
+	TagLocation                  Tag = "Location"
+	TagGrouping                  Tag = "Grouping"
+	TagComment                   Tag = "Comment"
+	TagDisc                      Tag = "Disc"
+	TagLabel                     Tag = "Label"
+	TagMusicbrainzArtistId       Tag = "MUSICBRAINZ_ARTISTID"
+	TagMusicbrainzAlbumId        Tag = "MUSICBRAINZ_ALBUMID"
+	TagMusicbrainzAlbumArtistId  Tag = "MUSICBRAINZ_ALBUMARTISTID"
+	TagMusicbrainzTrackId        Tag = "MUSICBRAINZ_TRACKID"
+	TagMusicbrainzReleaseGroupId Tag = "MUSICBRAINZ_RELEASEGROUPID"
+	TagMusicbrainzReleaseTrackId Tag = "MUSICBRAINZ_RELEASETRACKID"
+	TagMusicbrainzWorkId         Tag = "MUSICBRAINZ_WORKID"
+)
+
+// Pseudo tags accepted by filters and sort options.
+const (
+	// matches any tag value of a song
+	TagAny Tag = "any"
+
+	// the song URI relative to the music directory
+	TagFile Tag = "file"
+
+	// the time stamp of the last modification of the song file
+	TagLastModified Tag = "Last-Modified"
+
+	// the time stamp when the song was added to the database
+	TagAdded Tag = "Added"
+
+	// the priority of a queue item
+	TagPrio Tag = "prio"
+)
@@ -0,0 +1,84 @@
+package mmpd
+
+import (
+	"net"
+	"time"
+)
+
+// Dialer opens connections to MPD. *net.Dialer implements it.
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// WithDialer makes the client open its connections with dialer, e.g. to
+// tunnel them or to inject failures in tests.
+func WithDialer(dialer Dialer) ClientOption {
+	return func(client *ReconnectingClient) {
+		client.dialer = dialer
+	}
+}
+
+// Clock provides the time for keepalives, reconnects and retries.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is a time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// WithClock replaces the system clock, so tests can advance keepalive and
+// reconnect timers deterministically.
+func WithClock(clock Clock) ClientOption {
+	return func(client *ReconnectingClient) {
+		client.clock = clock
+	}
+}
+
+// systemClock is the Clock of the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// startBridge routes the connections of the client through a bridge if they
+// are made with a custom dialer or recorded.
+func (c *ReconnectingClient) startBridge() {
+	if c.dialer == nil && c.recorder == nil {
+		return
+	}
+
+	var dialer Dialer = &net.Dialer{}
+	if c.dialer != nil {
+		dialer = c.dialer
+	}
+	recorder := c.recorder
+	c.bridge = newBridge(func() (net.Conn, error) {
+		conn, err := dialer.Dial(c.network, c.addr)
+		if err != nil || recorder == nil {
+			return conn, err
+		}
+		return recorder.Wrap(conn), nil
+	})
+}